@@ -11,6 +11,11 @@
 // Package api contains common definitions used for client and server.
 package api
 
+import (
+	"strings"
+	"time"
+)
+
 // ZettelID contains the identifier of a zettel. It is a string with 14 digits.
 type ZettelID string
 
@@ -31,6 +36,40 @@ func (zid ZettelID) IsValid() bool {
 	return true
 }
 
+// zidLayout is the time layout of a zettel identifier.
+const zidLayout = "20060102150405"
+
+// minCreatedZid is the smallest identifier of a zettel that is not
+// predefined by the Zettelstore.
+const minCreatedZid = ZettelID("00010101000000")
+
+// Next returns the identifier of the following second. A Zettelstore uses
+// it, if a zettel was already created within the same second.
+func (zid ZettelID) Next() ZettelID { return zid.OffsetBySeconds(1) }
+
+// OffsetBySeconds returns the identifier that is the given number of seconds
+// after (or before, if negative) the given identifier. InvalidZID is
+// returned, if the identifier does not encode a time, or if the result would
+// be in the range of predefined identifier.
+func (zid ZettelID) OffsetBySeconds(n int) ZettelID {
+	if !zid.IsValid() {
+		return InvalidZID
+	}
+	t, err := time.Parse(zidLayout, string(zid))
+	if err != nil {
+		return InvalidZID
+	}
+	result := ZettelID(t.Add(time.Duration(n) * time.Second).Format(zidLayout))
+	if len(result) != LengthZid || result < minCreatedZid {
+		return InvalidZID
+	}
+	return result
+}
+
+// Compare returns -1, 0, or 1, if the identifier is less, equal, or greater
+// than the other identifier.
+func (zid ZettelID) Compare(other ZettelID) int { return strings.Compare(string(zid), string(other)) }
+
 // ZettelMeta is a map containg the metadata of a zettel.
 type ZettelMeta map[string]string
 
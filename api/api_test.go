@@ -0,0 +1,115 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestZidNext(t *testing.T) {
+	testcases := []struct {
+		zid api.ZettelID
+		exp api.ZettelID
+	}{
+		{"20230704120102", "20230704120103"},
+		{"20230704120159", "20230704120200"},
+		{"20230704235959", "20230705000000"},
+		{"20230228235959", "20230301000000"},
+		{"20240228235959", "20240229000000"},
+		{"20231231235959", "20240101000000"},
+		{"00010100595959", api.InvalidZID},
+		{"00010101000000", "00010101000001"},
+		{"99991231235959", api.InvalidZID},
+		{api.ZidDefaultHome, api.InvalidZID},
+		{api.ZidVersion, api.InvalidZID},
+		{"20231304120102", api.InvalidZID},
+		{"2023", api.InvalidZID},
+	}
+	for _, tc := range testcases {
+		if got := tc.zid.Next(); got != tc.exp {
+			t.Errorf("%q: expected %q, but got %q", tc.zid, tc.exp, got)
+		}
+	}
+}
+
+func TestZidOffsetBySeconds(t *testing.T) {
+	testcases := []struct {
+		zid api.ZettelID
+		n   int
+		exp api.ZettelID
+	}{
+		{"20230704120102", 0, "20230704120102"},
+		{"20230704120102", 58, "20230704120200"},
+		{"20230704120102", 86400, "20230705120102"},
+		{"20230705000000", -1, "20230704235959"},
+		{"00010101000001", -1, "00010101000000"},
+		{"00010101000001", -2, api.InvalidZID},
+	}
+	for _, tc := range testcases {
+		if got := tc.zid.OffsetBySeconds(tc.n); got != tc.exp {
+			t.Errorf("%q%+d: expected %q, but got %q", tc.zid, tc.n, tc.exp, got)
+		}
+	}
+}
+
+func TestZidCompare(t *testing.T) {
+	testcases := []struct {
+		a, b api.ZettelID
+		exp  int
+	}{
+		{"20230704120102", "20230704120102", 0},
+		{"20230704120102", "20230704120103", -1},
+		{"20230704120103", "20230704120102", 1},
+		{api.ZidVersion, api.ZidDefaultHome, -1},
+	}
+	for _, tc := range testcases {
+		if got := tc.a.Compare(tc.b); got != tc.exp {
+			t.Errorf("%q<=>%q: expected %d, but got %d", tc.a, tc.b, tc.exp, got)
+		}
+	}
+}
+
+func TestParseUselessFiles(t *testing.T) {
+	testcases := []struct {
+		val string
+		exp []string
+	}{
+		{"", nil},
+		{"20230101000000.zettel", []string{"20230101000000.zettel"}},
+		{"20230101000000 Old title.zettel 20230101000000.meta",
+			[]string{"20230101000000 Old title.zettel", "20230101000000.meta"}},
+		{"20230101000000  two  spaces.md 20230101000000.txt",
+			[]string{"20230101000000  two  spaces.md", "20230101000000.txt"}},
+		{"other file.txt 20230101000000.md", []string{"other file.txt", "20230101000000.md"}},
+	}
+	for _, tc := range testcases {
+		got := api.ParseUselessFiles(tc.val)
+		if strings.Join(got, "|") != strings.Join(tc.exp, "|") || len(got) != len(tc.exp) {
+			t.Errorf("%q: expected %q, but got %q", tc.val, tc.exp, got)
+		}
+	}
+}
+
+func TestGetBoxInfo(t *testing.T) {
+	bi := api.GetBoxInfo(api.ZettelMeta{
+		api.KeyBoxNumber:    "2",
+		api.KeyUselessFiles: "20230101000000 a b.zettel 20230101000000.txt",
+	})
+	if bi.Number != 2 || len(bi.UselessFiles) != 2 || bi.UselessFiles[0] != "20230101000000 a b.zettel" {
+		t.Errorf("unexpected box info: %v", bi)
+	}
+	if bi = api.GetBoxInfo(api.ZettelMeta{api.KeyBoxNumber: "x"}); bi.Number != 0 || bi.UselessFiles != nil {
+		t.Errorf("empty box info expected, but got %v", bi)
+	}
+}
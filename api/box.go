@@ -0,0 +1,54 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BoxInfo contains information about the box that stores a zettel.
+type BoxInfo struct {
+	Number       int      // Number of the box, starting with 1; 0 if unknown
+	UselessFiles []string // Files of a directory box that are not used for the zettel
+}
+
+// GetBoxInfo returns the box information stored in the metadata of a zettel.
+func GetBoxInfo(m ZettelMeta) BoxInfo {
+	var bi BoxInfo
+	if n, err := strconv.Atoi(m[KeyBoxNumber]); err == nil && n > 0 {
+		bi.Number = n
+	}
+	bi.UselessFiles = ParseUselessFiles(m[KeyUselessFiles])
+	return bi
+}
+
+// ParseUselessFiles splits the value of the metadata key "useless-files" into
+// file names. The Zettelstore separates the names by a space, but file names
+// may contain spaces too. Since every file name of a directory box starts with
+// the zettel identifier, a new name starts only with an identifier.
+func ParseUselessFiles(val string) []string {
+	var result []string
+	for _, field := range strings.Split(val, " ") {
+		if len(result) > 0 && !startsWithZid(field) {
+			result[len(result)-1] += " " + field
+			continue
+		}
+		if field != "" {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func startsWithZid(s string) bool {
+	return len(s) >= LengthZid && ZettelID(s[:LengthZid]).IsValid()
+}
@@ -65,20 +65,23 @@ const (
 // LengthZid factors the constant length of a zettel identifier
 const LengthZid = len(ZidDefaultHome)
 
+// MetaKind is the type of the value of a metadata key.
+type MetaKind string
+
 // Values of the metadata key/value type.
 const (
-	MetaCredential   = "Credential"
-	MetaEmpty        = "EString"
-	MetaID           = "Identifier"
-	MetaIDSet        = "IdentifierSet"
-	MetaNumber       = "Number"
-	MetaString       = "String"
-	MetaTagSet       = "TagSet"
-	MetaTimestamp    = "Timestamp"
-	MetaURL          = "URL"
-	MetaWord         = "Word"
-	MetaWordSet      = "WordSet"
-	MetaZettelmarkup = "Zettelmarkup"
+	MetaCredential   MetaKind = "Credential"
+	MetaEmpty        MetaKind = "EString"
+	MetaID           MetaKind = "Identifier"
+	MetaIDSet        MetaKind = "IdentifierSet"
+	MetaNumber       MetaKind = "Number"
+	MetaString       MetaKind = "String"
+	MetaTagSet       MetaKind = "TagSet"
+	MetaTimestamp    MetaKind = "Timestamp"
+	MetaURL          MetaKind = "URL"
+	MetaWord         MetaKind = "Word"
+	MetaWordSet      MetaKind = "WordSet"
+	MetaZettelmarkup MetaKind = "Zettelmarkup"
 )
 
 // Predefined general Metadata keys
@@ -156,6 +159,7 @@ const (
 	HeaderContentType = "Content-Type"
 	HeaderDestination = "Destination"
 	HeaderLocation    = "Location"
+	HeaderWarning     = "Warning"
 )
 
 // Values for HTTP query parameter.
@@ -244,6 +248,11 @@ const (
 	PartZettel  = "zettel"
 )
 
+// IsValidPart returns true, if the given string is a supported part value.
+func IsValidPart(part string) bool {
+	return part == PartMeta || part == PartContent || part == PartZettel
+}
+
 // Command to be executed atthe Zettelstore
 type Command string
 
@@ -0,0 +1,68 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"mime"
+	"strings"
+)
+
+// Content types of encoded zettel.
+const (
+	ContentTypeHTML     = "text/html; charset=utf-8"
+	ContentTypeJSON     = "application/json"
+	ContentTypeMarkdown = "text/markdown; charset=utf-8"
+	ContentTypeText     = "text/plain; charset=utf-8"
+	ContentTypeBinary   = "application/octet-stream"
+)
+
+var mapEncodingContentType = map[EncodingEnum]string{
+	EncoderHTML:  ContentTypeHTML,
+	EncoderMD:    ContentTypeMarkdown,
+	EncoderSHTML: ContentTypeText,
+	EncoderSz:    ContentTypeText,
+	EncoderText:  ContentTypeText,
+	EncoderZmk:   ContentTypeText,
+	EncoderPlain: ContentTypeText,
+	EncoderData:  ContentTypeText,
+	EncoderJson:  ContentTypeJSON,
+}
+
+// ContentType returns the content type of a zettel with the given encoding.
+// Encodings that produce s-expressions, like sz, shtml, and data, are plain
+// text. For an unknown encoding, a generic binary content type is returned.
+func (e EncodingEnum) ContentType() string {
+	if ct, found := mapEncodingContentType[e]; found {
+		return ct
+	}
+	return ContentTypeBinary
+}
+
+// EncodingFromContentType returns the encoding for the given content type.
+// Since many encodings share the plain text content type, EncoderPlain is
+// returned for it. Parameters of the content type are ignored.
+func EncodingFromContentType(ct string) EncodingEnum {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return EncoderUnknown
+	}
+	switch strings.ToLower(mediaType) {
+	case "text/html":
+		return EncoderHTML
+	case "text/markdown":
+		return EncoderMD
+	case "text/plain":
+		return EncoderPlain
+	case "application/json":
+		return EncoderJson
+	}
+	return EncoderUnknown
+}
@@ -0,0 +1,55 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestContentType(t *testing.T) {
+	testcases := []struct {
+		enc  api.EncodingEnum
+		ct   string
+		back api.EncodingEnum
+	}{
+		{api.EncoderUnknown, "application/octet-stream", api.EncoderUnknown},
+		{api.EncoderHTML, "text/html; charset=utf-8", api.EncoderHTML},
+		{api.EncoderMD, "text/markdown; charset=utf-8", api.EncoderMD},
+		{api.EncoderSHTML, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderSz, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderText, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderZmk, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderPlain, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderData, "text/plain; charset=utf-8", api.EncoderPlain},
+		{api.EncoderJson, "application/json", api.EncoderJson},
+		{api.EncodingEnum(200), "application/octet-stream", api.EncoderUnknown},
+	}
+	for _, tc := range testcases {
+		ct := tc.enc.ContentType()
+		if ct != tc.ct {
+			t.Errorf("%v: expected content type %q, but got %q", tc.enc, tc.ct, ct)
+		}
+		if got := api.EncodingFromContentType(ct); got != tc.back {
+			t.Errorf("%q: expected encoding %v, but got %v", ct, tc.back, got)
+		}
+	}
+
+	for _, ct := range []string{"", "text", "image/png", "application/rss+xml", "text/plain; charset"} {
+		if got := api.EncodingFromContentType(ct); got != api.EncoderUnknown {
+			t.Errorf("%q: unknown encoding expected, but got %v", ct, got)
+		}
+	}
+	if got := api.EncodingFromContentType("Text/HTML"); got != api.EncoderHTML {
+		t.Errorf("content type must be case-insensitive, but got %v", got)
+	}
+}
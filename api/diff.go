@@ -0,0 +1,150 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"zettelstore.de/c/maps"
+)
+
+// MetaDiff describes the differences between two versions of metadata.
+type MetaDiff struct {
+	Added   ZettelMeta            // Keys only found in the new version, with their value
+	Removed ZettelMeta            // Keys only found in the old version, with their value
+	Changed map[string]MetaChange // Keys with a different value
+}
+
+// MetaChange describes the change of a metadata value. For keys with a set
+// value, like tags, the added and removed elements are listed too.
+type MetaChange struct {
+	Old, New string
+
+	AddedElems   []string
+	RemovedElems []string
+}
+
+// DiffMeta returns the differences between two versions of metadata. Keys
+// whose values are computed by the Zettelstore are ignored. Values of a set
+// kind, e.g. MetaTagSet, are compared as sets, i.e. the order of their
+// elements does not matter.
+func DiffMeta(oldMeta, newMeta ZettelMeta) MetaDiff {
+	return DiffMetaIgnore(oldMeta, newMeta, IsComputed)
+}
+
+// DiffMetaIgnore works like DiffMeta, but ignores all keys for which the given
+// function returns true. If the function is nil, no key is ignored.
+func DiffMetaIgnore(oldMeta, newMeta ZettelMeta, ignore func(key string) bool) MetaDiff {
+	diff := MetaDiff{Added: ZettelMeta{}, Removed: ZettelMeta{}, Changed: map[string]MetaChange{}}
+	for key, oldVal := range oldMeta {
+		if ignore != nil && ignore(key) {
+			continue
+		}
+		newVal, found := newMeta[key]
+		if !found {
+			diff.Removed[key] = oldVal
+			continue
+		}
+		if change, changed := diffValue(KindOf(key), oldVal, newVal); changed {
+			diff.Changed[key] = change
+		}
+	}
+	for key, newVal := range newMeta {
+		if ignore != nil && ignore(key) {
+			continue
+		}
+		if _, found := oldMeta[key]; !found {
+			diff.Added[key] = newVal
+		}
+	}
+	return diff
+}
+
+func diffValue(kind MetaKind, oldVal, newVal string) (MetaChange, bool) {
+	change := MetaChange{Old: oldVal, New: newVal}
+	var oldElems, newElems []string
+	switch kind {
+	case MetaTagSet:
+		oldElems, newElems = ParseTagSet(oldVal), ParseTagSet(newVal)
+	case MetaWordSet, MetaIDSet:
+		oldElems, newElems = ParseWordSet(oldVal), ParseWordSet(newVal)
+	default:
+		return change, oldVal != newVal
+	}
+	change.AddedElems = missingElems(newElems, oldElems)
+	change.RemovedElems = missingElems(oldElems, newElems)
+	return change, len(change.AddedElems) > 0 || len(change.RemovedElems) > 0
+}
+
+// missingElems returns all elements of elems that are not in other.
+func missingElems(elems, other []string) []string {
+	set := make(map[string]bool, len(other))
+	for _, e := range other {
+		set[e] = true
+	}
+	var result []string
+	for _, e := range elems {
+		if !set[e] {
+			set[e] = true
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// IsEmpty returns true, if there are no differences.
+func (md MetaDiff) IsEmpty() bool {
+	return len(md.Added) == 0 && len(md.Removed) == 0 && len(md.Changed) == 0
+}
+
+// String returns a compact summary of the differences, ordered by key, e.g.
+// `+role "zettel"; -url; tags +#b -#a; title "A" -> "B"`.
+func (md MetaDiff) String() string {
+	if md.IsEmpty() {
+		return "no changes"
+	}
+	keys := make([]string, 0, len(md.Added)+len(md.Removed)+len(md.Changed))
+	keys = append(keys, maps.Keys(md.Added)...)
+	keys = append(keys, maps.Keys(md.Removed)...)
+	keys = append(keys, maps.Keys(md.Changed)...)
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if val, found := md.Added[key]; found {
+			parts = append(parts, "+"+key+" "+strconv.Quote(val))
+		} else if _, found = md.Removed[key]; found {
+			parts = append(parts, "-"+key)
+		} else {
+			parts = append(parts, md.Changed[key].summary(key))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (mc MetaChange) summary(key string) string {
+	if len(mc.AddedElems) == 0 && len(mc.RemovedElems) == 0 {
+		return key + " " + strconv.Quote(mc.Old) + " -> " + strconv.Quote(mc.New)
+	}
+	var sb strings.Builder
+	sb.WriteString(key)
+	for _, e := range mc.AddedElems {
+		sb.WriteString(" +")
+		sb.WriteString(e)
+	}
+	for _, e := range mc.RemovedElems {
+		sb.WriteString(" -")
+		sb.WriteString(e)
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestDiffMeta(t *testing.T) {
+	testcases := []struct {
+		name   string
+		oldVal api.ZettelMeta
+		newVal api.ZettelMeta
+		exp    string
+	}{
+		{"empty", nil, nil, "no changes"},
+		{"same", api.ZettelMeta{"title": "T"}, api.ZettelMeta{"title": "T"}, "no changes"},
+		{"tag order", api.ZettelMeta{"tags": "#a #b"}, api.ZettelMeta{"tags": "#b  a #a"}, "no changes"},
+		{"computed", api.ZettelMeta{"modified": "20230101000000"}, api.ZettelMeta{"modified": "20230102000000", "back": "20230101000001"}, "no changes"},
+		{"value", api.ZettelMeta{"title": "A"}, api.ZettelMeta{"title": "B"}, `title "A" -> "B"`},
+		{"added removed", api.ZettelMeta{"url": "https://x"}, api.ZettelMeta{"role": "zettel"}, `+role "zettel"; -url`},
+		{"tags", api.ZettelMeta{"tags": "#a #b", "title": "T"}, api.ZettelMeta{"tags": "#c #b #d", "title": "T"}, "tags +#c +#d -#a"},
+		{"id set", api.ZettelMeta{"precursor": "20230101000000"}, api.ZettelMeta{"precursor": "20230101000001 20230101000000"}, "precursor +20230101000001"},
+		{"word set", api.ZettelMeta{"my-set": "a b"}, api.ZettelMeta{"my-set": "b a"}, "no changes"},
+	}
+	for _, tc := range testcases {
+		diff := api.DiffMeta(tc.oldVal, tc.newVal)
+		if got := diff.String(); got != tc.exp {
+			t.Errorf("%s: expected %q, but got %q", tc.name, tc.exp, got)
+		}
+		if diff.IsEmpty() != (tc.exp == "no changes") {
+			t.Errorf("%s: IsEmpty is %v for %v", tc.name, diff.IsEmpty(), diff)
+		}
+	}
+
+	diff := api.DiffMeta(api.ZettelMeta{"tags": "#a", "title": "A"}, api.ZettelMeta{"tags": "#b", "title": "B"})
+	change := diff.Changed["tags"]
+	if change.Old != "#a" || change.New != "#b" || len(change.AddedElems) != 1 || change.AddedElems[0] != "#b" ||
+		len(change.RemovedElems) != 1 || change.RemovedElems[0] != "#a" {
+		t.Errorf("unexpected tag change: %+v", change)
+	}
+	if change = diff.Changed["title"]; change.Old != "A" || change.New != "B" || change.AddedElems != nil {
+		t.Errorf("unexpected title change: %+v", change)
+	}
+}
+
+func TestDiffMetaIgnore(t *testing.T) {
+	oldMeta := api.ZettelMeta{"title": "A", "modified": "20230101000000"}
+	newMeta := api.ZettelMeta{"title": "B", "modified": "20230102000000"}
+	if got, exp := api.DiffMetaIgnore(oldMeta, newMeta, nil).String(), `modified "20230101000000" -> "20230102000000"; title "A" -> "B"`; got != exp {
+		t.Errorf("nothing ignored: expected %q, but got %q", exp, got)
+	}
+	ignore := func(key string) bool { return key == api.KeyTitle }
+	if got, exp := api.DiffMetaIgnore(oldMeta, newMeta, ignore).String(), `modified "20230101000000" -> "20230102000000"`; got != exp {
+		t.Errorf("title ignored: expected %q, but got %q", exp, got)
+	}
+}
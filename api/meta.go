@@ -0,0 +1,130 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"zettelstore.de/c/maps"
+)
+
+// computedKeys contains all metadata keys whose values are calculated by the
+// Zettelstore. Values for these keys are ignored by the server.
+var computedKeys = map[string]bool{
+	KeyBack:         true,
+	KeyBackward:     true,
+	KeyBoxNumber:    true,
+	KeyDead:         true,
+	KeyFolge:        true,
+	KeyForward:      true,
+	KeyModified:     true,
+	KeyPublished:    true,
+	KeySubordinates: true,
+	KeySuccessors:   true,
+}
+
+// IsComputed returns true, if the value of the given metadata key is
+// calculated by the Zettelstore.
+func IsComputed(key string) bool { return computedKeys[key] }
+
+// IsValidKey returns true, if the given string is a valid metadata key.
+func IsValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if ch := key[i]; !isKeyChar(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyChar(ch byte) bool {
+	return ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') || ch == '-'
+}
+
+// ErrEmptySyntax is returned, if the syntax value is empty.
+var ErrEmptySyntax = errors.New("empty syntax value")
+
+// Validate checks the zettel data and returns all problems found. The metadata
+// is expected to be in canonical form, see Canonicalize.
+func (zd *ZettelData) Validate() []error {
+	var result []error
+	for _, key := range maps.Keys(zd.Meta) {
+		val := zd.Meta[key]
+		if !IsValidKey(key) {
+			result = append(result, fmt.Errorf("invalid metadata key %q", key))
+			continue
+		}
+		if IsComputed(key) {
+			result = append(result, fmt.Errorf("metadata key %q is computed by the Zettelstore", key))
+			continue
+		}
+		switch kind := KindOf(key); {
+		case key == KeySyntax:
+			if val == "" {
+				result = append(result, ErrEmptySyntax)
+			} else if !isWord(val) {
+				result = append(result, fmt.Errorf("invalid syntax value %q", val))
+			}
+		case key == KeyTags:
+			for _, tag := range ParseWordSet(val) {
+				if len(tag) < 2 || tag[0] != '#' {
+					result = append(result, fmt.Errorf("invalid tag %q", tag))
+				}
+			}
+		case kind == MetaID || kind == MetaIDSet:
+			for _, zid := range ParseWordSet(val) {
+				if !ZettelID(zid).IsValid() {
+					result = append(result, fmt.Errorf("invalid zettel identifier %q for key %q", zid, key))
+				}
+			}
+		}
+	}
+	return result
+}
+
+func isWord(s string) bool {
+	for _, ch := range s {
+		if ch <= ' ' || ch == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonicalize normalizes the metadata of the zettel data: keys are
+// lowercased, keys and values are trimmed, tags are prefixed with a '#' and
+// de-duplicated, and keys computed by the Zettelstore are removed.
+func (zd *ZettelData) Canonicalize() {
+	if len(zd.Meta) == 0 {
+		return
+	}
+	meta := make(ZettelMeta, len(zd.Meta))
+	for _, key := range maps.Keys(zd.Meta) {
+		val := strings.TrimSpace(zd.Meta[key])
+		key = strings.ToLower(strings.TrimSpace(key))
+		if IsComputed(key) {
+			continue
+		}
+		switch key {
+		case KeySyntax:
+			val = strings.ToLower(val)
+		case KeyTags:
+			val = JoinWordSet(ParseTagSet(val))
+		}
+		meta[key] = val
+	}
+	zd.Meta = meta
+}
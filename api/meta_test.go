@@ -0,0 +1,160 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"zettelstore.de/c/api"
+)
+
+func TestCanonicalize(t *testing.T) {
+	testcases := []struct {
+		name string
+		meta api.ZettelMeta
+		exp  api.ZettelMeta
+	}{
+		{"empty", nil, nil},
+		{"lowercase key", api.ZettelMeta{"Title": "T"}, api.ZettelMeta{"title": "T"}},
+		{"trim", api.ZettelMeta{" title ": " T \n"}, api.ZettelMeta{"title": "T"}},
+		{"syntax", api.ZettelMeta{"syntax": "ZMK"}, api.ZettelMeta{"syntax": "zmk"}},
+		{"tags", api.ZettelMeta{"tags": "a  #b ##c # a"}, api.ZettelMeta{"tags": "#a #b #c"}},
+		{"computed", api.ZettelMeta{"title": "T", "published": "20230101000000", "backward": "1", "forward": "2"}, api.ZettelMeta{"title": "T"}},
+	}
+	for _, tc := range testcases {
+		zd := api.ZettelData{Meta: tc.meta}
+		zd.Canonicalize()
+		if len(zd.Meta) != len(tc.exp) {
+			t.Errorf("%s: expected %v, but got %v", tc.name, tc.exp, zd.Meta)
+			continue
+		}
+		for k, v := range tc.exp {
+			if got, found := zd.Meta[k]; !found || got != v {
+				t.Errorf("%s: expected %v, but got %v", tc.name, tc.exp, zd.Meta)
+				break
+			}
+		}
+	}
+}
+
+func TestCanonicalizeNoAlias(t *testing.T) {
+	orig := api.ZettelMeta{"Title": "T"}
+	zd := api.ZettelData{Meta: orig}
+	zd.Canonicalize()
+	if _, found := orig["title"]; found {
+		t.Error("original metadata was modified")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name string
+		meta api.ZettelMeta
+		exp  int
+	}{
+		{"empty", nil, 0},
+		{"valid", api.ZettelMeta{"title": "T", "syntax": "zmk", "tags": "#a #b", "precursor": "20230101000000"}, 0},
+		{"invalid key", api.ZettelMeta{"Title": "T", "a b": "c"}, 2},
+		{"computed", api.ZettelMeta{"modified": "20230101000000"}, 1},
+		{"empty syntax", api.ZettelMeta{"syntax": ""}, 1},
+		{"invalid syntax", api.ZettelMeta{"syntax": "z mk"}, 1},
+		{"invalid tags", api.ZettelMeta{"tags": "a #b # #c"}, 2},
+		{"invalid zid", api.ZettelMeta{"superior": "20230101000000 123", "predecessor": "x"}, 2},
+	}
+	for _, tc := range testcases {
+		zd := api.ZettelData{Meta: tc.meta}
+		if errs := zd.Validate(); len(errs) != tc.exp {
+			t.Errorf("%s: expected %d errors, but got %v", tc.name, tc.exp, errs)
+		}
+	}
+}
+
+func TestKindOfPredefinedKeys(t *testing.T) {
+	// All constants "Key..." of file const.go are predefined metadata keys.
+	f, err := parser.ParseFile(token.NewFileSet(), "const.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		vs, isValueSpec := n.(*ast.ValueSpec)
+		if !isValueSpec || len(vs.Names) != 1 || len(vs.Values) != 1 || !strings.HasPrefix(vs.Names[0].Name, "Key") {
+			return true
+		}
+		if lit, isLit := vs.Values[0].(*ast.BasicLit); isLit && lit.Kind == token.STRING {
+			key, _ := strconv.Unquote(lit.Value)
+			keys[key] = true
+		}
+		return true
+	})
+	if len(keys) == 0 {
+		t.Fatal("no predefined keys found")
+	}
+
+	// Keys with a value of type EString.
+	emptyKeys := map[string]bool{api.KeyLicense: true, api.KeyQuery: true}
+	for key := range keys {
+		if kind := api.KindOf(key); kind == api.MetaEmpty && !emptyKeys[key] {
+			t.Errorf("key %q has no predefined kind", key)
+		}
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	testcases := []struct {
+		key string
+		exp api.MetaKind
+	}{
+		{api.KeyTags, api.MetaTagSet},
+		{api.KeyModified, api.MetaTimestamp},
+		{api.KeyPrecursor, api.MetaIDSet},
+		{"my-role", api.MetaWord},
+		{"home-url", api.MetaURL},
+		{"next-zid", api.MetaID},
+		{"next-zids", api.MetaIDSet},
+		{"abc", api.MetaEmpty},
+	}
+	for _, tc := range testcases {
+		if got := api.KindOf(tc.key); got != tc.exp {
+			t.Errorf("KindOf(%q): expected %q, but got %q", tc.key, tc.exp, got)
+		}
+	}
+}
+
+func TestMetaKindHelper(t *testing.T) {
+	tm := time.Date(2023, 7, 31, 12, 34, 56, 0, time.Local)
+	ts := api.FormatTimestamp(tm)
+	if ts != "20230731123456" {
+		t.Errorf("FormatTimestamp: expected %q, but got %q", "20230731123456", ts)
+	}
+	if got, ok := api.ParseTimestamp(ts); !ok || !got.Equal(tm) {
+		t.Errorf("ParseTimestamp(%q): expected %v, but got %v/%v", ts, tm, got, ok)
+	}
+	for _, s := range []string{"", "2023", "20231301000000", "202301010000000"} {
+		if _, ok := api.ParseTimestamp(s); ok {
+			t.Errorf("ParseTimestamp(%q) must fail", s)
+		}
+	}
+
+	tags := api.ParseTagSet(" a  #b ##c # a\t#b")
+	if got := api.JoinWordSet(tags); got != "#a #b #c" {
+		t.Errorf("ParseTagSet: expected %q, but got %q", "#a #b #c", got)
+	}
+	if got := api.ParseWordSet(" x  y\nz "); len(got) != 3 || api.JoinWordSet(got) != "x y z" {
+		t.Errorf("ParseWordSet: expected [x y z], but got %v", got)
+	}
+}
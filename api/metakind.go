@@ -0,0 +1,129 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// keyKinds maps all predefined metadata keys to the type of their value.
+var keyKinds = map[string]MetaKind{
+	KeyID:           MetaID,
+	KeyTitle:        MetaZettelmarkup,
+	KeyRole:         MetaWord,
+	KeyTags:         MetaTagSet,
+	KeySyntax:       MetaWord,
+	KeyAuthor:       MetaString,
+	KeyBack:         MetaIDSet,
+	KeyBackward:     MetaIDSet,
+	KeyBoxNumber:    MetaNumber,
+	KeyCopyright:    MetaString,
+	KeyCreated:      MetaTimestamp,
+	KeyCredential:   MetaCredential,
+	KeyDead:         MetaIDSet,
+	KeyExpire:       MetaTimestamp,
+	KeyFolge:        MetaIDSet,
+	KeyFolgeRole:    MetaWord,
+	KeyForward:      MetaIDSet,
+	KeyLang:         MetaWord,
+	KeyLicense:      MetaEmpty,
+	KeyModified:     MetaTimestamp,
+	KeyPrecursor:    MetaIDSet,
+	KeyPredecessor:  MetaID,
+	KeyPublished:    MetaTimestamp,
+	KeyQuery:        MetaEmpty,
+	KeyReadOnly:     MetaWord,
+	KeySubordinates: MetaIDSet,
+	KeySuccessors:   MetaIDSet,
+	KeySuperior:     MetaIDSet,
+	KeySummary:      MetaZettelmarkup,
+	KeyURL:          MetaURL,
+	KeyUselessFiles: MetaString,
+	KeyUserID:       MetaWord,
+	KeyUserRole:     MetaWord,
+	KeyVisibility:   MetaWord,
+}
+
+// keySuffixKinds maps suffixes of user-defined keys to the type of their
+// value, as the Zettelstore does.
+var keySuffixKinds = []struct {
+	suffix string
+	kind   MetaKind
+}{
+	{"-number", MetaNumber},
+	{"-role", MetaWord},
+	{"-set", MetaWordSet},
+	{"-title", MetaZettelmarkup},
+	{"-url", MetaURL},
+	{"-zid", MetaID},
+	{"-zids", MetaIDSet},
+}
+
+// KindOf returns the type of the value of the given metadata key. For keys
+// that are not predefined, the type is derived from the suffix of the key.
+// All other keys store an EString.
+func KindOf(key string) MetaKind {
+	if kind, found := keyKinds[key]; found {
+		return kind
+	}
+	for _, sk := range keySuffixKinds {
+		if strings.HasSuffix(key, sk.suffix) {
+			return sk.kind
+		}
+	}
+	return MetaEmpty
+}
+
+// FormatTimestamp returns the string representation of a time value with
+// kind MetaTimestamp. The time zone of the given time is ignored.
+func FormatTimestamp(t time.Time) string { return t.Format(zidLayout) }
+
+// ParseTimestamp parses a value of kind MetaTimestamp. Since the value does
+// not contain any zone information, the local time zone is used.
+func ParseTimestamp(val string) (time.Time, bool) {
+	if len(val) != len(zidLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(zidLayout, val, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ParseWordSet splits a value of kind MetaWordSet (or MetaIDSet) into its
+// words.
+func ParseWordSet(val string) []string { return strings.Fields(val) }
+
+// ParseTagSet splits a value of kind MetaTagSet into its tags. Every tag
+// starts with exactly one '#'. Empty tags and duplicates are removed.
+func ParseTagSet(val string) []string {
+	words := ParseWordSet(val)
+	result := make([]string, 0, len(words))
+	seen := make(map[string]bool, len(words))
+	for _, tag := range words {
+		tag = strings.TrimLeft(tag, "#")
+		if tag == "" {
+			continue
+		}
+		tag = "#" + tag
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// JoinWordSet returns the value of kind MetaWordSet (or MetaTagSet, or
+// MetaIDSet) for the given words.
+func JoinWordSet(words []string) string { return strings.Join(words, " ") }
@@ -0,0 +1,110 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"zettelstore.de/c/maps"
+)
+
+// firstKeys are written before all other metadata keys, in this order.
+var firstKeys = []string{KeyTitle, KeyRole, KeyTags, KeySyntax}
+
+// FormatZettel returns a zettel in the plain text format of the Zettelstore:
+// a header of lines "key: value", an empty line, and the content. Keys
+// "title", "role", "tags", and "syntax" are written first, all other keys in
+// alphabetical order. A value that contains line breaks is folded into
+// continuation lines, which start with a space. Since ParseZettel joins them
+// with a space, line breaks are not preserved. Invalid keys are ignored.
+func FormatZettel(meta ZettelMeta, content []byte) []byte {
+	var buf bytes.Buffer
+	for _, key := range firstKeys {
+		if val, found := meta[key]; found {
+			writeMetaLine(&buf, key, val)
+		}
+	}
+	for _, key := range maps.Keys(meta) {
+		if isFirstKey(key) || !IsValidKey(key) {
+			continue
+		}
+		writeMetaLine(&buf, key, meta[key])
+	}
+	buf.WriteByte('\n')
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+func isFirstKey(key string) bool {
+	for _, k := range firstKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMetaLine(buf *bytes.Buffer, key, val string) {
+	buf.WriteString(key)
+	buf.WriteByte(':')
+	first := true
+	for _, line := range strings.FieldsFunc(val, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !first {
+			buf.WriteString("\n ")
+		} else {
+			buf.WriteByte(' ')
+			first = false
+		}
+		buf.WriteString(line)
+	}
+	buf.WriteByte('\n')
+}
+
+// ParseZettel splits a zettel in the plain text format of the Zettelstore
+// into its metadata and its content, see FormatZettel. Header lines that start
+// with a space continue the value of the previous line.
+func ParseZettel(data []byte) (ZettelMeta, []byte, error) {
+	meta := ZettelMeta{}
+	lastKey := ""
+	for len(data) > 0 {
+		line := data
+		rest := []byte(nil)
+		if pos := bytes.IndexByte(data, '\n'); pos >= 0 {
+			line, rest = data[:pos], data[pos+1:]
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		data = rest
+		if len(bytes.TrimSpace(line)) == 0 {
+			return meta, data, nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastKey == "" {
+				return nil, nil, errors.New("metadata header starts with continuation line")
+			}
+			meta[lastKey] = strings.TrimSpace(meta[lastKey] + " " + string(bytes.TrimSpace(line)))
+			continue
+		}
+		key, val, found := strings.Cut(string(line), ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found || !IsValidKey(key) {
+			return nil, nil, fmt.Errorf("invalid metadata line %q", line)
+		}
+		meta[key] = strings.TrimSpace(val)
+		lastKey = key
+	}
+	return meta, nil, nil
+}
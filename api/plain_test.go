@@ -0,0 +1,80 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestFormatZettel(t *testing.T) {
+	meta := api.ZettelMeta{
+		"zz":       "last",
+		"syntax":   "zmk",
+		"title":    "A: B",
+		"url":      "https://zettelstore.de/a:b",
+		"summary":  "line 1\nline 2\r\n\n  line 3",
+		"Invalid!": "x",
+		"empty":    "",
+	}
+	exp := "title: A: B\nsyntax: zmk\nempty:\nsummary: line 1\n line 2\n line 3\nurl: https://zettelstore.de/a:b\nzz: last\n\nContent\n"
+	if got := string(api.FormatZettel(meta, []byte("Content\n"))); got != exp {
+		t.Errorf("expected\n%q\nbut got\n%q", exp, got)
+	}
+	if got := string(api.FormatZettel(nil, []byte("c"))); got != "\nc" {
+		t.Errorf("empty metadata: expected %q, but got %q", "\nc", got)
+	}
+}
+
+func TestParseZettel(t *testing.T) {
+	testcases := []struct {
+		name    string
+		meta    api.ZettelMeta
+		content string
+		exp     api.ZettelMeta
+	}{
+		{"empty", api.ZettelMeta{}, "", api.ZettelMeta{}},
+		{"simple", api.ZettelMeta{"title": "T", "tags": "#a #b"}, "Text\n\nMore\n", nil},
+		{"colon", api.ZettelMeta{"title": "a: b", "url": "http://x:8080/"}, ":x", nil},
+		{"newline", api.ZettelMeta{"summary": "a\nb\n\nc"}, "c", api.ZettelMeta{"summary": "a b c"}},
+		{"empty value", api.ZettelMeta{"role": ""}, "c", nil},
+	}
+	for _, tc := range testcases {
+		data := api.FormatZettel(tc.meta, []byte(tc.content))
+		meta, content, err := api.ParseZettel(data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		exp := tc.exp
+		if exp == nil {
+			exp = tc.meta
+		}
+		if len(meta) != len(exp) {
+			t.Errorf("%s: expected %v, but got %v", tc.name, exp, meta)
+		}
+		for k, v := range exp {
+			if got, found := meta[k]; !found || got != v {
+				t.Errorf("%s: key %q: expected %q, but got %q/%v", tc.name, k, v, got, found)
+			}
+		}
+		if string(content) != tc.content {
+			t.Errorf("%s: expected content %q, but got %q", tc.name, tc.content, content)
+		}
+	}
+
+	for _, src := range []string{" title: T\n\nc", "a b: c\n\n", "title\n\n"} {
+		if _, _, err := api.ParseZettel([]byte(src)); err == nil {
+			t.Errorf("%q: error expected", src)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"strings"
+	"unicode"
+)
+
+// queryDirectives contains all words that have a special meaning in a query.
+var queryDirectives = map[string]bool{
+	BackwardDirective: true,
+	ContextDirective:  true,
+	CostDirective:     true,
+	ForwardDirective:  true,
+	IdentDirective:    true,
+	ItemsDirective:    true,
+	MaxDirective:      true,
+	LimitDirective:    true,
+	OffsetDirective:   true,
+	OrDirective:       true,
+	OrderDirective:    true,
+	PickDirective:     true,
+	RandomDirective:   true,
+	ReverseDirective:  true,
+}
+
+// querySpecialChars contains all characters of search operators and of the
+// action separator, as well as the characters used for quoting.
+const querySpecialChars = `!=:[]~<>?|"\`
+
+// NeedsQuotes returns true, if the given value must be quoted to be used as a
+// single value within a query.
+func NeedsQuotes(s string) bool {
+	if s == "" || queryDirectives[s] {
+		return true
+	}
+	for _, ch := range s {
+		if unicode.IsSpace(ch) || unicode.IsControl(ch) || strings.ContainsRune(querySpecialChars, ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryEscapeValue returns the given value in a form that can be used as a
+// single value within a query. If needed, the value is enclosed in double
+// quotes, and embedded quotes and backslashes are escaped with a backslash.
+func QueryEscapeValue(s string) string {
+	if !NeedsQuotes(s) {
+		return s
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; ch == '"' || ch == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
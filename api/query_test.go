@@ -0,0 +1,86 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestQueryEscapeValue(t *testing.T) {
+	testcases := []struct {
+		val string
+		exp string
+	}{
+		{"", `""`},
+		{"foo", "foo"},
+		{"#tag", "#tag"},
+		{"foo bar", `"foo bar"`},
+		{"a:b", `"a:b"`},
+		{"!x", `"!x"`},
+		{"x|y", `"x|y"`},
+		{"OR", `"OR"`},
+		{"or", "or"},
+		{`say "hi"`, `"say \"hi\""`},
+		{`a\b`, `"a\\b"`},
+		{"tab\there", "\"tab\there\""},
+	}
+	for _, tc := range testcases {
+		if got := api.QueryEscapeValue(tc.val); got != tc.exp {
+			t.Errorf("QueryEscapeValue(%q) should be %q, but got %q", tc.val, tc.exp, got)
+		}
+	}
+}
+
+// parseQueryValue is a reference parser for a single value of a query. It
+// returns the value and the rest of the query.
+func parseQueryValue(s string) (string, string) {
+	if s == "" || s[0] != '"' {
+		if pos := strings.IndexFunc(s, func(r rune) bool { return r == ' ' }); pos >= 0 {
+			return s[:pos], s[pos:]
+		}
+		return s, ""
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '"':
+			return sb.String(), s[i+1:]
+		case '\\':
+			i++
+			if i < len(s) {
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), ""
+}
+
+func FuzzQueryEscapeValue(f *testing.F) {
+	for _, seed := range []string{"", "foo", "foo bar", `"`, `\`, `\"`, `a" OR b`, "x:y", "ORDER", "ä ö"} {
+		f.Add(seed)
+	}
+	const rest = " title:x"
+	f.Fuzz(func(t *testing.T, s string) {
+		esc := api.QueryEscapeValue(s)
+		if !api.NeedsQuotes(s) && esc != s {
+			t.Errorf("%q must not be changed, but got %q", s, esc)
+		}
+		val, r := parseQueryValue(esc + rest)
+		if val != s || r != rest {
+			t.Errorf("%q escaped as %q, parsed as %q with rest %q", s, esc, val, r)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// MarshalRightsAsNames controls the JSON encoding of ZettelRights. If true,
+// rights are encoded as a list of names, e.g. ["read","write"]. Otherwise, the
+// default, they are encoded as a number, as expected by the Zettelstore.
+var MarshalRightsAsNames = false
+
+// rightsNames lists the names of all rights, in the order of their bits.
+var rightsNames = []string{"none", "create", "read", "write", "rename", "delete"}
+
+// Names returns the names of all rights that are set.
+func (zr ZettelRights) Names() []string {
+	var result []string
+	for i, name := range rightsNames {
+		if zr&(1<<i) != 0 {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// MarshalJSON encodes the rights as a number or as a list of names, depending
+// on MarshalRightsAsNames.
+func (zr ZettelRights) MarshalJSON() ([]byte, error) {
+	if !MarshalRightsAsNames {
+		return strconv.AppendUint(nil, uint64(zr), 10), nil
+	}
+	names := zr.Names()
+	if names == nil {
+		names = []string{}
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON decodes rights that are encoded as a number or as a list of
+// names.
+func (zr *ZettelRights) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var names []string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return err
+		}
+		var result ZettelRights
+	nameLoop:
+		for _, name := range names {
+			for i, rn := range rightsNames {
+				if rn == name {
+					result |= 1 << i
+					continue nameLoop
+				}
+			}
+			return fmt.Errorf("unknown zettel right %q", name)
+		}
+		*zr = result
+		return nil
+	}
+	var n uint8
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*zr = ZettelRights(n)
+	return nil
+}
@@ -0,0 +1,84 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestRightsUnmarshal(t *testing.T) {
+	testcases := []struct {
+		data string
+		exp  api.ZettelRights
+	}{
+		// Recorded responses of a Zettelstore
+		{`{"meta":{"title":"Home"},"rights":62}`, api.ZettelCanCreate | api.ZettelCanRead | api.ZettelCanWrite | api.ZettelCanRename | api.ZettelCanDelete},
+		{`{"meta":{},"rights":4}`, api.ZettelCanRead},
+		{`{"meta":{},"rights":1}`, api.ZettelCanNone},
+		{`{"meta":{}}`, 0},
+
+		{`{"meta":{},"rights":["read","write"]}`, api.ZettelCanRead | api.ZettelCanWrite},
+		{`{"meta":{},"rights":[]}`, 0},
+	}
+	for i, tc := range testcases {
+		var mj api.MetaJSON
+		if err := json.Unmarshal([]byte(tc.data), &mj); err != nil {
+			t.Errorf("%d: %s: %v", i, tc.data, err)
+			continue
+		}
+		if mj.Rights != tc.exp {
+			t.Errorf("%d: %s: expected %v, but got %v", i, tc.data, tc.exp, mj.Rights)
+		}
+	}
+
+	for _, data := range []string{`{"rights":["read","fly"]}`, `{"rights":"read"}`, `{"rights":256}`} {
+		var mj api.MetaJSON
+		if err := json.Unmarshal([]byte(data), &mj); err == nil {
+			t.Errorf("%s: error expected, but got %v", data, mj.Rights)
+		}
+	}
+}
+
+func TestRightsMarshal(t *testing.T) {
+	mj := api.MetaJSON{Meta: api.ZettelMeta{}, Rights: api.ZettelCanRead | api.ZettelCanWrite}
+	data, err := json.Marshal(mj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := string(data), `{"meta":{},"rights":12}`; got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+
+	api.MarshalRightsAsNames = true
+	defer func() { api.MarshalRightsAsNames = false }()
+	if data, err = json.Marshal(mj); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := string(data), `{"meta":{},"rights":["read","write"]}`; got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+	var mj2 api.MetaJSON
+	if err = json.Unmarshal(data, &mj2); err != nil {
+		t.Fatal(err)
+	}
+	if mj2.Rights != mj.Rights {
+		t.Errorf("round trip: expected %v, but got %v", mj.Rights, mj2.Rights)
+	}
+	if data, err = json.Marshal(api.MetaJSON{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := string(data), `{"meta":null,"rights":[]}`; got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+}
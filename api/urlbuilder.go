@@ -27,15 +27,24 @@ type URLBuilder struct {
 	fragment string
 }
 
-// NewURLBuilder creates a new URL builder with the given prefix and key.
+// NewURLBuilder creates a new URL builder with the given prefix and key. The
+// prefix may contain a path, e.g. "https://example.com/zs", if the Zettelstore
+// is served behind a reverse proxy. A missing trailing slash of a non-empty
+// prefix is added. An empty prefix results in relative URLs. A key of '/'
+// results in URLs directly below the prefix.
 func NewURLBuilder(prefix string, key byte) *URLBuilder {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
 	return &URLBuilder{prefix: prefix, key: key}
 }
 
 // Clone an URLBuilder
 func (ub *URLBuilder) Clone() *URLBuilder {
 	cpy := new(URLBuilder)
+	cpy.prefix = ub.prefix
 	cpy.key = ub.key
+	cpy.rawLocal = ub.rawLocal
 	if len(ub.path) > 0 {
 		cpy.path = make([]string, 0, len(ub.path))
 		cpy.path = append(cpy.path, ub.path...)
@@ -82,14 +91,53 @@ func (ub *URLBuilder) AppendPath(p string) *URLBuilder {
 	return ub
 }
 
-// AppendKVQuery adds a new key/value query parameter
+// AppendKVQuery adds a new key/value query parameter. Key and value will be
+// escaped. If the value is empty, only the key will be written.
 func (ub *URLBuilder) AppendKVQuery(key, value string) *URLBuilder {
 	ub.rawLocal = ""
 	ub.query = append(ub.query, urlQuery{key, value})
 	return ub
 }
 
-// AppendQuery adds a new query
+// WithEncoding sets the encoding query parameter. A previously set encoding
+// is replaced. It panics if the encoding is unknown.
+func (ub *URLBuilder) WithEncoding(enc EncodingEnum) *URLBuilder {
+	encoding, found := mapEnumEncoding[enc]
+	if !found {
+		panic("Unknown encoding " + enc.String())
+	}
+	return ub.setKVQuery(QueryKeyEncoding, encoding)
+}
+
+// WithPart sets the part query parameter. A previously set part is replaced.
+// It panics if the part is not valid.
+func (ub *URLBuilder) WithPart(part string) *URLBuilder {
+	if !IsValidPart(part) {
+		panic("Invalid part " + part)
+	}
+	return ub.setKVQuery(QueryKeyPart, part)
+}
+
+// WithParseOnly sets the query parameter to retrieve the parsed zettel, not
+// the evaluated one. It is set at most once.
+func (ub *URLBuilder) WithParseOnly() *URLBuilder {
+	return ub.setKVQuery(QueryKeyParseOnly, "")
+}
+
+// setKVQuery sets the value of the given query key, replacing a previous value.
+func (ub *URLBuilder) setKVQuery(key, value string) *URLBuilder {
+	ub.rawLocal = ""
+	for i, q := range ub.query {
+		if q.key == key {
+			ub.query[i].val = value
+			return ub
+		}
+	}
+	ub.query = append(ub.query, urlQuery{key, value})
+	return ub
+}
+
+// AppendQuery adds a new query. An empty query results in the query key only.
 func (ub *URLBuilder) AppendQuery(value string) *URLBuilder {
 	ub.rawLocal = ""
 	ub.query = append(ub.query, urlQuery{QueryKeyQuery, value})
@@ -119,8 +167,11 @@ func (ub *URLBuilder) String() string {
 	if ub.key != '/' {
 		sb.WriteByte(ub.key)
 	}
-	if ub.rawLocal != "" {
-		sb.WriteString(ub.rawLocal)
+	if rawLocal := ub.rawLocal; rawLocal != "" {
+		if ub.key != '/' && rawLocal[0] != '?' && rawLocal[0] != '#' {
+			sb.WriteByte('/')
+		}
+		sb.WriteString(rawLocal)
 		return sb.String()
 	}
 	for i, p := range ub.path {
@@ -129,21 +180,21 @@ func (ub *URLBuilder) String() string {
 		}
 		sb.WriteString(url.PathEscape(p))
 	}
-	if len(ub.fragment) > 0 {
-		sb.WriteByte('#')
-		sb.WriteString(ub.fragment)
-	}
 	for i, q := range ub.query {
 		if i == 0 {
 			sb.WriteByte('?')
 		} else {
 			sb.WriteByte('&')
 		}
-		sb.WriteString(q.key)
+		sb.WriteString(url.QueryEscape(q.key))
 		if val := q.val; val != "" {
 			sb.WriteByte('=')
 			sb.WriteString(url.QueryEscape(val))
 		}
 	}
+	if len(ub.fragment) > 0 {
+		sb.WriteByte('#')
+		sb.WriteString(ub.fragment)
+	}
 	return sb.String()
 }
@@ -0,0 +1,173 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api_test
+
+import (
+	"testing"
+
+	"zettelstore.de/c/api"
+)
+
+func TestURLBuilderQuery(t *testing.T) {
+	testcases := []struct {
+		key string
+		val string
+		exp string
+	}{
+		{api.QueryKeyEncoding, api.EncodingJson, "/z?enc=json"},
+		{api.QueryKeyParseOnly, "", "/z?parseonly"},
+		{api.QueryKeySeed, "1", "/z?_seed=1"},
+		{"a b", "c d", "/z?a+b=c+d"},
+		{"a&b", "c&d", "/z?a%26b=c%26d"},
+		{"a=b", "c=d", "/z?a%3Db=c%3Dd"},
+		{"äöü", "ß", "/z?%C3%A4%C3%B6%C3%BC=%C3%9F"},
+		{"key:", "", "/z?key%3A"},
+	}
+	for _, tc := range testcases {
+		got := api.NewURLBuilder("/", 'z').AppendKVQuery(tc.key, tc.val).String()
+		if got != tc.exp {
+			t.Errorf("%q=%q: expected %q, but got %q", tc.key, tc.val, tc.exp, got)
+		}
+	}
+}
+
+func TestURLBuilderAppendQuery(t *testing.T) {
+	testcases := []struct {
+		query string
+		exp   string
+	}{
+		{"", "/z?q"},
+		{"title:a b", "/z?q=title%3Aa+b"},
+		{"a=b&c", "/z?q=a%3Db%26c"},
+	}
+	for _, tc := range testcases {
+		got := api.NewURLBuilder("/", 'z').AppendQuery(tc.query).String()
+		if got != tc.exp {
+			t.Errorf("%q: expected %q, but got %q", tc.query, tc.exp, got)
+		}
+	}
+	got := api.NewURLBuilder("/", 'z').AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson).AppendQuery("").String()
+	if exp := "/z?enc=json&q"; got != exp {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+}
+
+func TestWebUIURL(t *testing.T) {
+	const zid = api.ZettelID("20230704120102")
+	testcases := []struct {
+		prefix string
+		fn     func(string, api.ZettelID) string
+		exp    string
+	}{
+		{"/", api.HTMLZettelURL, "/h/20230704120102"},
+		{"", api.HTMLZettelURL, "h/20230704120102"},
+		{"/zs", api.HTMLZettelURL, "/zs/h/20230704120102"},
+		{"/zs/", api.HTMLZettelURL, "/zs/h/20230704120102"},
+		{"https://example.com", api.EditURL, "https://example.com/e/20230704120102"},
+		{"https://example.com/", api.EditURL, "https://example.com/e/20230704120102"},
+		{"/zs", api.InfoURL, "/zs/i/20230704120102"},
+		{"/zs/", api.InfoURL, "/zs/i/20230704120102"},
+	}
+	for _, tc := range testcases {
+		if got := tc.fn(tc.prefix, zid); got != tc.exp {
+			t.Errorf("%q: expected %q, but got %q", tc.prefix, tc.exp, got)
+		}
+	}
+	got := api.NewURLBuilder("/zs", api.WebUIKeyCreate).SetZid(zid).AppendKVQuery(api.QueryKeyCommand, "folge").String()
+	if exp := "/zs/c/20230704120102?cmd=folge"; got != exp {
+		t.Errorf("expected %q, but got %q", exp, got)
+	}
+}
+
+func TestURLBuilderWith(t *testing.T) {
+	testcases := []struct {
+		ub  *api.URLBuilder
+		exp string
+	}{
+		{api.NewURLBuilder("/", 'z').WithEncoding(api.EncoderSz), "/z?enc=sz"},
+		{api.NewURLBuilder("/", 'z').WithEncoding(api.EncoderSz).WithEncoding(api.EncoderJson), "/z?enc=json"},
+		{api.NewURLBuilder("/", 'z').WithPart(api.PartMeta).WithEncoding(api.EncoderData).WithPart(api.PartZettel), "/z?part=zettel&enc=data"},
+		{api.NewURLBuilder("/", 'z').WithParseOnly().AppendQuery("a").WithParseOnly(), "/z?parseonly&q=a"},
+	}
+	for i, tc := range testcases {
+		if got := tc.ub.String(); got != tc.exp {
+			t.Errorf("%d: expected %q, but got %q", i, tc.exp, got)
+		}
+	}
+}
+
+func TestURLBuilderWithInvalid(t *testing.T) {
+	for name, fn := range map[string]func(*api.URLBuilder){
+		"encoding": func(ub *api.URLBuilder) { ub.WithEncoding(api.EncoderUnknown) },
+		"part":     func(ub *api.URLBuilder) { ub.WithPart("all") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: panic expected", name)
+				}
+			}()
+			fn(api.NewURLBuilder("/", 'z'))
+		}()
+	}
+}
+
+func TestURLBuilderPrefix(t *testing.T) {
+	const zid = api.ZettelID("20230704120102")
+	prefixes := []struct {
+		prefix string
+		base   string
+	}{
+		{"", ""},
+		{"/", "/"},
+		{"/zk", "/zk/"},
+		{"/zk/", "/zk/"},
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/", "https://example.com/"},
+		{"https://example.com/zk", "https://example.com/zk/"},
+		{"https://example.com/zk/", "https://example.com/zk/"},
+	}
+	testcases := []struct {
+		name  string
+		key   byte
+		build func(*api.URLBuilder) *api.URLBuilder
+		exp   string
+	}{
+		{"empty", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub }, "z"},
+		{"empty", 'a', func(ub *api.URLBuilder) *api.URLBuilder { return ub }, "a"},
+		{"empty", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub }, ""},
+		{"zid", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetZid(zid) }, "z/20230704120102"},
+		{"zid", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetZid(zid) }, "20230704120102"},
+		{"path", 'x', func(ub *api.URLBuilder) *api.URLBuilder { return ub.AppendPath("/a").AppendPath("b c") }, "x/a/b%20c"},
+		{"path", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub.AppendPath("a").AppendPath("/b") }, "a/b"},
+		{"query", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.AppendQuery("a b") }, "z?q=a+b"},
+		{"query", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub.AppendQuery("a") }, "?q=a"},
+		{"fragment", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetZid(zid).SetFragment("f") }, "z/20230704120102#f"},
+		{"fragment", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetFragment("f") }, "#f"},
+		{"query+fragment", 'z', func(ub *api.URLBuilder) *api.URLBuilder {
+			return ub.SetZid(zid).SetFragment("f").WithEncoding(api.EncoderSz)
+		}, "z/20230704120102?enc=sz#f"},
+		{"raw", 'x', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetRawLocal("/a/b?c=d") }, "x/a/b?c=d"},
+		{"raw", '/', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetRawLocal("a/b") }, "a/b"},
+		{"raw query", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetRawLocal("?q=a") }, "z?q=a"},
+		{"raw fragment", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetRawLocal("#f") }, "z#f"},
+		{"clone", 'o', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetZid(zid).Clone().AppendQuery("a") }, "o/20230704120102?q=a"},
+		{"clone raw", 'z', func(ub *api.URLBuilder) *api.URLBuilder { return ub.SetRawLocal("a").Clone() }, "z/a"},
+	}
+	for _, p := range prefixes {
+		for _, tc := range testcases {
+			got := tc.build(api.NewURLBuilder(p.prefix, tc.key)).String()
+			if exp := p.base + tc.exp; got != exp {
+				t.Errorf("%q/%q/%s: expected %q, but got %q", p.prefix, tc.key, tc.name, exp, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package api
+
+// Keys of the WebUI endpoints, to be used with NewURLBuilder.
+const (
+	WebUIKeyZettel = 'h' // Show zettel as HTML
+	WebUIKeyEdit   = 'e' // Edit zettel
+	WebUIKeyInfo   = 'i' // Show zettel information
+	WebUIKeyCreate = 'c' // Create a new zettel, based on another zettel
+	WebUIKeyDelete = 'd' // Delete zettel
+	WebUIKeyRename = 'b' // Rename zettel
+)
+
+// HTMLZettelURL returns the URL to show the given zettel in the WebUI.
+func HTMLZettelURL(prefix string, zid ZettelID) string {
+	return NewURLBuilder(prefix, WebUIKeyZettel).SetZid(zid).String()
+}
+
+// EditURL returns the URL of the WebUI page to edit the given zettel.
+func EditURL(prefix string, zid ZettelID) string {
+	return NewURLBuilder(prefix, WebUIKeyEdit).SetZid(zid).String()
+}
+
+// InfoURL returns the URL of the WebUI page that shows information about the
+// given zettel.
+func InfoURL(prefix string, zid ZettelID) string {
+	return NewURLBuilder(prefix, WebUIKeyInfo).SetZid(zid).String()
+}
@@ -11,6 +11,7 @@
 package attrs_test
 
 import (
+	"strings"
 	"testing"
 
 	"zettelstore.de/c/attrs"
@@ -73,3 +74,87 @@ func TestHasClass(t *testing.T) {
 		}
 	}
 }
+
+func TestSanitize(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		attrs attrs.Attributes
+		exp   string
+	}{
+		{nil, ""},
+		{attrs.Attributes{"-": "", "id": "x", "title": "onclick"}, "-,id,title"},
+		{attrs.Attributes{"onclick": "alert(1)", "OnLoad": "x", "id": "x"}, "id"},
+		{attrs.Attributes{"style": "background:url(javascript:alert(1))", "class": "c"}, "class"},
+		{attrs.Attributes{"href": "javascript:alert(1)"}, ""},
+		{attrs.Attributes{"href": " JavaScript:alert(1)"}, ""},
+		{attrs.Attributes{"href": "java\tscript:alert(1)"}, ""},
+		{attrs.Attributes{"href": "vbscript:msgbox"}, ""},
+		{attrs.Attributes{"href": "data:text/html;base64,PHNjcmlwdD4="}, ""},
+		{attrs.Attributes{"src": "data:image/png;base64,AAAA"}, "src"},
+		{attrs.Attributes{"href": "https://zettelstore.de/", "src": "/img.png"}, "href,src"},
+		{attrs.Attributes{"title": "javascript:alert(1)"}, "title"},
+	}
+	for i, tc := range testcases {
+		orig := tc.attrs.Clone()
+		got := strings.Join(attrs.Sanitize(tc.attrs, nil).Keys(), ",")
+		if got != tc.exp {
+			t.Errorf("%d: %v: expected keys %q, but got %q", i, tc.attrs, tc.exp, got)
+		}
+		if len(orig) != len(tc.attrs) {
+			t.Errorf("%d: attributes were modified: %v", i, tc.attrs)
+		}
+	}
+
+	policy := func(key, _ string) bool { return key != "id" }
+	if got := strings.Join(attrs.Sanitize(attrs.Attributes{"id": "x", "onclick": "y"}, policy).Keys(), ","); got != "onclick" {
+		t.Errorf("custom policy: expected onclick, but got %q", got)
+	}
+}
+
+func TestAttrString(t *testing.T) {
+	t.Parallel()
+	testcases := []struct {
+		a   attrs.Attributes
+		exp string
+	}{
+		{nil, "{}"},
+		{attrs.Attributes{"title": "T"}, `{title="T"}`},
+		{attrs.Attributes{"b": "2", "a": "1", "-": ""}, `{a="1" b="2" -}`},
+		{attrs.Attributes{"-": "d"}, `{-="d"}`},
+		{attrs.Attributes{"class": "x  y", "id": "i", "z": ""}, `{z="" .x .y #i}`},
+		{attrs.Attributes{"class": "", "id": "a b"}, `{class="" id="a b"}`},
+		{attrs.Attributes{"class": `a"b`}, `{class="a\"b"}`},
+		{attrs.Attributes{"title": `say "hi" \o/`}, `{title="say \"hi\" \\o/"}`},
+		{attrs.Attributes{"": "g", "#x": "y"}, `{""="g" "#x"="y"}`},
+	}
+	for _, tc := range testcases {
+		if got := tc.a.String(); got != tc.exp {
+			t.Errorf("%v: expected %s, but got %s", map[string]string(tc.a), tc.exp, got)
+			continue
+		}
+		var a attrs.Attributes
+		if err := a.UnmarshalText([]byte(tc.exp)); err != nil {
+			t.Errorf("%s: %v", tc.exp, err)
+			continue
+		}
+		if got := a.String(); got != tc.exp {
+			t.Errorf("round trip of %s resulted in %s", tc.exp, got)
+		}
+	}
+}
+
+func TestAttrUnmarshalText(t *testing.T) {
+	t.Parallel()
+	var a attrs.Attributes
+	if err := a.UnmarshalText([]byte(` { .a #i key .b -="x" } `)); err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{key="" .a .b #i -="x"}`; a.String() != exp {
+		t.Errorf("expected %s, but got %s", exp, a.String())
+	}
+	for _, src := range []string{"", "{", `{a="b}`, `{a=b}`, "{.}", "{} x", `{a="\`, "{=}"} {
+		if err := a.UnmarshalText([]byte(src)); err == nil {
+			t.Errorf("%q: error expected, but got %s", src, a.String())
+		}
+	}
+}
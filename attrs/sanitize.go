@@ -0,0 +1,76 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package attrs
+
+import "strings"
+
+// SanitizePolicy decides whether an attribute with the given key and value
+// is allowed within HTML output.
+type SanitizePolicy func(key, value string) bool
+
+// DefaultSanitizePolicy drops event handler attributes ("on..."), style
+// attributes, and URL attributes with a "javascript:", "vbscript:", or
+// "data:" scheme. Data URLs for images are allowed.
+func DefaultSanitizePolicy(key, value string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "on") || key == "style" {
+		return false
+	}
+	if urlKeys[key] {
+		return isSafeURL(value)
+	}
+	return true
+}
+
+// urlKeys contains the keys of all attributes that may contain an URL.
+var urlKeys = map[string]bool{
+	"action":     true,
+	"formaction": true,
+	"href":       true,
+	"poster":     true,
+	"src":        true,
+	"xlink:href": true,
+}
+
+func isSafeURL(s string) bool {
+	// Browsers ignore control characters and spaces within the scheme.
+	s = strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, s))
+	switch {
+	case strings.HasPrefix(s, "javascript:"), strings.HasPrefix(s, "vbscript:"):
+		return false
+	case strings.HasPrefix(s, "data:"):
+		return strings.HasPrefix(s, "data:image/")
+	}
+	return true
+}
+
+// Sanitize returns a copy of the attributes that contains only the attributes
+// allowed by the policy. A nil policy is the default policy.
+func Sanitize(a Attributes, policy SanitizePolicy) Attributes {
+	if a == nil {
+		return nil
+	}
+	if policy == nil {
+		policy = DefaultSanitizePolicy
+	}
+	result := make(Attributes, len(a))
+	for k, v := range a {
+		if policy(k, v) {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,230 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package attrs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// String returns a canonical textual representation of the attributes, e.g.
+// `{key="value" .class1 .class2 #id -}`. Keys are sorted, classes and the id
+// use their shorthand forms, if possible, and the default attribute comes last.
+func (a Attributes) String() string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	writeSep := func() {
+		if sb.Len() > 1 {
+			sb.WriteByte(' ')
+		}
+	}
+	classes, simpleClasses := a.GetClasses(), true
+	for _, cls := range classes {
+		simpleClasses = simpleClasses && isSimpleWord(cls)
+	}
+	id, hasID := a["id"]
+	simpleID := hasID && isSimpleWord(id)
+	for _, key := range a.Keys() {
+		if key == DefaultAttribute || (key == "id" && simpleID) || (key == "class" && simpleClasses && len(classes) > 0) {
+			continue
+		}
+		writeSep()
+		if isSimpleKey(key) {
+			sb.WriteString(key)
+		} else {
+			writeQuoted(&sb, key)
+		}
+		sb.WriteByte('=')
+		writeQuoted(&sb, a[key])
+	}
+	if simpleClasses {
+		for _, cls := range classes {
+			writeSep()
+			sb.WriteByte('.')
+			sb.WriteString(cls)
+		}
+	}
+	if simpleID {
+		writeSep()
+		sb.WriteByte('#')
+		sb.WriteString(id)
+	}
+	if val, found := a[DefaultAttribute]; found {
+		writeSep()
+		sb.WriteString(DefaultAttribute)
+		if val != "" {
+			sb.WriteByte('=')
+			writeQuoted(&sb, val)
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func writeQuoted(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; ch == '"' || ch == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+}
+
+func isSimpleWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; ch <= ' ' || strings.IndexByte(`"\={}`, ch) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func isSimpleKey(key string) bool {
+	return isSimpleWord(key) && key != DefaultAttribute && key[0] != '.' && key[0] != '#'
+}
+
+// MarshalText encodes the attributes in the form of String.
+func (a Attributes) MarshalText() ([]byte, error) { return []byte(a.String()), nil }
+
+// UnmarshalText decodes attributes that were encoded by MarshalText.
+func (a *Attributes) UnmarshalText(text []byte) error {
+	p := textParser{s: string(text)}
+	result, err := p.parse()
+	if err != nil {
+		return err
+	}
+	*a = result
+	return nil
+}
+
+// ErrInvalidText is returned if a textual representation of attributes is
+// not valid.
+var ErrInvalidText = errors.New("invalid attributes text")
+
+type textParser struct {
+	s   string
+	pos int
+}
+
+func (p *textParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrInvalidText, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *textParser) parse() (Attributes, error) {
+	p.skipSpace()
+	if !p.consume('{') {
+		return nil, p.errorf("missing '{'")
+	}
+	result := Attributes{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("missing '}'")
+		}
+		switch ch := p.s[p.pos]; ch {
+		case '}':
+			p.pos++
+			p.skipSpace()
+			if p.pos < len(p.s) {
+				return nil, p.errorf("unexpected text after '}'")
+			}
+			return result, nil
+		case '.', '#':
+			p.pos++
+			word := p.word()
+			if word == "" {
+				return nil, p.errorf("missing name after %q", ch)
+			}
+			if ch == '.' {
+				result = result.AddClass(word)
+			} else {
+				result["id"] = word
+			}
+		default:
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			val := ""
+			if p.consume('=') {
+				if val, err = p.quoted(); err != nil {
+					return nil, err
+				}
+			}
+			result[key] = val
+		}
+	}
+}
+
+func (p *textParser) key() (string, error) {
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		return p.quoted()
+	}
+	if key := p.word(); key != "" {
+		return key, nil
+	}
+	return "", p.errorf("missing key")
+}
+
+func (p *textParser) word() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		if ch := p.s[p.pos]; ch <= ' ' || strings.IndexByte(`"\={}`, ch) >= 0 {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *textParser) quoted() (string, error) {
+	if !p.consume('"') {
+		return "", p.errorf("missing '\"'")
+	}
+	var sb strings.Builder
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		p.pos++
+		switch ch {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if p.pos >= len(p.s) {
+				return "", p.errorf("incomplete escape")
+			}
+			sb.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *textParser) consume(ch byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *textParser) skipSpace() {
+	for p.pos < len(p.s) && p.s[p.pos] <= ' ' {
+		p.pos++
+	}
+}
@@ -16,17 +16,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"zettelstore.de/c/api"
 	"zettelstore.de/c/sx"
+	"zettelstore.de/c/sz"
 	"zettelstore.de/sx.fossil/sxpf"
 	"zettelstore.de/sx.fossil/sxpf/reader"
 )
@@ -36,17 +40,68 @@ type Client struct {
 	base      string
 	username  string
 	password  string
+	authMx    sync.Mutex   // serializes authentication requests
+	tokenMx   sync.RWMutex // protects token, tokenType, and expires
 	token     string
 	tokenType string
 	expires   time.Time
 	client    http.Client
+	timeout   time.Duration // applies to requests whose context has no deadline
+	userAgent string
+
+	slowThreshold time.Duration
+	slowLogf      SlowRequestFunc
+	validate      bool
+	noAuth        bool
+	redirects     bool // true iff redirects are followed
+	compress      bool // true iff request and response bodies are compressed
+	retryAll      bool // true iff all requests are retried after re-authentication
+	warnFunc      func(string)
+	metrics       metrics
+	defaultHeader http.Header
 }
 
+// Version of this client library.
+const Version = "0.12.0-dev"
+
+// userAgent is the value of the User-Agent header of all requests.
+const userAgent = "zettelstore-client-go/" + Version
+
+// Option configures a client when it is created.
+type Option func(*Client)
+
+// WithValidation lets the client canonicalize and validate zettel data before
+// it is sent to the Zettelstore.
+func WithValidation() Option { return func(c *Client) { c.validate = true } }
+
+// WithNoAuth lets the client send all requests without authentication, even
+// if authentication data was set. This is useful for public Zettelstores.
+func WithNoAuth() Option { return func(c *Client) { c.noAuth = true } }
+
+// WithFollowRedirects lets the client follow redirects of the Zettelstore, e.g.
+// if it is placed behind a path-rewriting proxy. By default, a redirect
+// results in a RedirectError.
+func WithFollowRedirects() Option { return func(c *Client) { c.redirects = true } }
+
+// WithRetryNonIdempotent lets the client retry all requests that were
+// rejected because of an invalid token, not only idempotent ones. See
+// ForceAuthenticate.
+func WithRetryNonIdempotent() Option { return func(c *Client) { c.retryAll = true } }
+
+// DefaultTimeout is the timeout of a request, if its context has no deadline.
+const DefaultTimeout = 10 * time.Second
+
+// WithDefaultTimeout sets the timeout of requests whose context has no
+// deadline, including reading the response. A value of zero or less disables
+// this timeout. The default value is DefaultTimeout. Requests with a deadline
+// are not limited by this timeout.
+func WithDefaultTimeout(d time.Duration) Option { return func(c *Client) { c.timeout = d } }
+
 // Base returns the base part of the URLs that are used to communicate with a Zettelstore.
 func (c *Client) Base() string { return c.base }
 
 // NewClient create a new client.
-func NewClient(u *url.URL) *Client {
+func NewClient(u *url.URL, opts ...Option) *Client {
 	myURL := *u
 	myURL.User = nil
 	myURL.ForceQuery = false
@@ -58,9 +113,10 @@ func NewClient(u *url.URL) *Client {
 		base += "/"
 	}
 	c := Client{
-		base: base,
+		base:      base,
+		timeout:   DefaultTimeout,
+		userAgent: userAgent,
 		client: http.Client{
-			Timeout: 10 * time.Second,
 			Transport: &http.Transport{
 				DialContext: (&net.Dialer{
 					Timeout: 5 * time.Second, // TCP connect timeout
@@ -69,9 +125,34 @@ func NewClient(u *url.URL) *Client {
 			},
 		},
 	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if !c.redirects {
+		c.client.CheckRedirect = checkRedirect
+	}
 	return &c
 }
 
+// RedirectError is returned, if the Zettelstore redirects a request and the
+// client does not follow redirects.
+type RedirectError struct {
+	Location string   // Target of the redirect
+	Via      []string // URLs of all previous requests, starting with the first one
+}
+
+func (err *RedirectError) Error() string {
+	return "unexpected redirect from " + err.Via[len(err.Via)-1] + " to " + err.Location
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	urls := make([]string, len(via))
+	for i, r := range via {
+		urls[i] = redactURL(r.URL)
+	}
+	return &RedirectError{Location: redactURL(req.URL), Via: urls}
+}
+
 // Error encapsulates the possible client call errors.
 type Error struct {
 	StatusCode int
@@ -113,6 +194,60 @@ func statusToError(resp *http.Response) error {
 	}
 }
 
+// ErrUnexpectedContentType is returned, if the content type of a successful
+// response does not match the requested encoding. This happens e.g. if a proxy
+// serves an HTML page instead of the Zettelstore.
+type ErrUnexpectedContentType struct {
+	ContentType string           // Content type of the response
+	Encoding    api.EncodingEnum // Requested encoding
+	Body        []byte           // Start of the response body
+}
+
+func (err *ErrUnexpectedContentType) Error() string {
+	return fmt.Sprintf("unexpected content type %q for encoding %v, body: %q", err.ContentType, err.Encoding, err.Body)
+}
+
+// maxContentTypeBody is the maximum number of bytes of a response body stored
+// in ErrUnexpectedContentType.
+const maxContentTypeBody = 200
+
+// QueryError is returned by methods that execute a query, if the Zettelstore
+// rejected the query as invalid.
+type QueryError struct {
+	Query   string
+	Message string // Explanation of the Zettelstore
+	Err     *Error
+}
+
+func (err *QueryError) Error() string {
+	return "invalid query " + strconv.Quote(err.Query) + ": " + err.Message
+}
+
+// Unwrap returns the underlying client error.
+func (err *QueryError) Unwrap() error { return err.Err }
+
+// maxQueryMessageLen limits the size of the message of a QueryError.
+const maxQueryMessageLen = 4096
+
+// queryStatusToError works like statusToError, but returns a QueryError for
+// a rejected query.
+func queryStatusToError(resp *http.Response, query string) error {
+	err := statusToError(resp)
+	cErr := err.(*Error)
+	if cErr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+	msg := cErr.Body
+	if len(msg) > maxQueryMessageLen {
+		msg = msg[:maxQueryMessageLen]
+	}
+	return &QueryError{
+		Query:   query,
+		Message: string(bytes.TrimSpace(bytes.ToValidUTF8(msg, nil))),
+		Err:     cErr,
+	}
+}
+
 func (c *Client) newURLBuilder(key byte) *api.URLBuilder {
 	return api.NewURLBuilder(c.base, key)
 }
@@ -120,20 +255,197 @@ func (*Client) newRequest(ctx context.Context, method string, ub *api.URLBuilder
 	return http.NewRequestWithContext(ctx, method, ub.String(), body)
 }
 
+// ZettelURL returns the URL the client uses to retrieve the given zettel,
+// e.g. for embedding it into a HTML page. Query parameters are appended in the
+// order of their keys.
+//
+// The URL does not contain any authentication data. If the Zettelstore
+// requires authentication, the URL is only useful for a caller that provides
+// its own credentials, e.g. a browser with a valid session.
+func (c *Client) ZettelURL(zid api.ZettelID, query url.Values) string {
+	ub := c.newURLBuilder('z').SetZid(zid)
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, val := range query[key] {
+			ub.AppendKVQuery(key, val)
+		}
+	}
+	return ub.String()
+}
+
+// ListURL returns the URL the client uses to list all zettel selected by the
+// given query. As with ZettelURL, no authentication data is included.
+func (c *Client) ListURL(query string) string {
+	return c.newURLBuilder('z').AppendQuery(query).String()
+}
+
+// SlowRequestFunc is called for every request that took longer than a given threshold.
+type SlowRequestFunc func(method, url string, d time.Duration)
+
+// SetSlowRequestThreshold sets a function that is called for every request
+// that took at least the given duration. The function is called synchronously
+// with the HTTP method, the URL without query and user data, and the duration
+// of the request. Therefore, it should return quickly. A nil function or a
+// non-positive duration disables the logging.
+func (c *Client) SetSlowRequestThreshold(d time.Duration, logf SlowRequestFunc) {
+	c.slowThreshold = d
+	c.slowLogf = logf
+}
+
+// SetWarningHandler sets a function that is called once for every warning
+// header of a response, e.g. when a deprecated query syntax was used.
+func (c *Client) SetWarningHandler(fn func(string)) { c.warnFunc = fn }
+
+// ErrAuthorizationHeader is returned when trying to set the authorization
+// header, which is managed by the client.
+var ErrAuthorizationHeader = errors.New("authorization header must not be set")
+
+// SetDefaultHeader sets a header that is sent with every request, e.g.
+// "Accept-Language", unless the request sets the header itself. An empty
+// value removes the default header. It should be called before the client is
+// used concurrently.
+func (c *Client) SetDefaultHeader(key, value string) error {
+	key = http.CanonicalHeaderKey(key)
+	if key == "Authorization" {
+		return ErrAuthorizationHeader
+	}
+	if value == "" {
+		delete(c.defaultHeader, key)
+		return nil
+	}
+	if c.defaultHeader == nil {
+		c.defaultHeader = http.Header{}
+	}
+	c.defaultHeader.Set(key, value)
+	return nil
+}
+
 func (c *Client) executeRequest(req *http.Request) (*http.Response, error) {
+	for key, val := range c.defaultHeader {
+		if _, found := req.Header[key]; !found {
+			req.Header[key] = val
+		}
+	}
+	c.tokenMx.RLock()
 	if c.token != "" {
 		req.Header.Add("Authorization", c.tokenType+" "+c.token)
 	}
-	resp, err := c.client.Do(req)
+	c.tokenMx.RUnlock()
+	if c.compress {
+		if err := compressRequest(req); err != nil {
+			return nil, err
+		}
+		// Setting the header disables the transparent decompression of the transport.
+		req.Header.Set(headerAcceptEncoding, encodingGzip)
+	}
+	start := time.Now()
+	resp, err := c.do(req)
+	d := time.Since(start)
+	c.recordMetrics(req, resp, err, d)
+	if logf := c.slowLogf; logf != nil && c.slowThreshold > 0 && d >= c.slowThreshold {
+		logf(req.Method, redactURL(req.URL), d)
+	}
 	if err != nil {
 		if resp != nil && resp.Body != nil {
 			resp.Body.Close()
 		}
 		return nil, err
 	}
+	if warnFunc := c.warnFunc; warnFunc != nil {
+		for _, warning := range resp.Header.Values(api.HeaderWarning) {
+			warnFunc(warning)
+		}
+	}
+	if c.compress {
+		decompressResponse(resp)
+	}
 	return resp, err
 }
 
+// SetUserAgent appends the given product token, e.g. "myapp/1.0", to the
+// User-Agent header of all requests. An empty string restores the default.
+func (c *Client) SetUserAgent(product string) {
+	if product == "" {
+		c.userAgent = userAgent
+	} else {
+		c.userAgent = userAgent + " " + product
+	}
+}
+
+// do sends the request. If the context of the request has no deadline, the
+// default timeout applies, until the response body is closed.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if _, found := req.Header["User-Agent"]; !found {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if _, hasDeadline := req.Context().Deadline(); hasDeadline || c.timeout <= 0 {
+		resp, err := c.client.Do(req)
+		return resp, contextError(req.Context(), err)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.timeout)
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		err = contextError(ctx, err)
+		cancel()
+		return resp, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// contextError makes sure that the error of a canceled or expired context can
+// be detected with errors.Is, even if the HTTP client did not wrap it.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", err, ctxErr)
+	}
+	return err
+}
+
+// IsTimeout returns true, if the error was caused by an expired deadline,
+// either of the context or of the network connection.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsCanceled returns true, if the error was caused by a canceled context.
+func IsCanceled(err error) bool { return errors.Is(err, context.Canceled) }
+
+// Close releases all idle network connections. The client can still be used
+// afterwards; it will open new connections as needed.
+func (c *Client) Close() { c.client.CloseIdleConnections() }
+
+// cancelBody cancels the context of a request when its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (cb *cancelBody) Close() error {
+	err := cb.ReadCloser.Close()
+	cb.cancel()
+	return err
+}
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.ForceQuery = false
+	redacted.RawQuery = ""
+	return redacted.String()
+}
+
 func (c *Client) buildAndExecuteRequest(
 	ctx context.Context, method string, ub *api.URLBuilder, body io.Reader, h http.Header) (*http.Response, error) {
 	req, err := c.newRequest(ctx, method, ub, body)
@@ -147,16 +459,83 @@ func (c *Client) buildAndExecuteRequest(
 	for key, val := range h {
 		req.Header[key] = append(req.Header[key], val...)
 	}
-	return c.executeRequest(req)
+	resp, err := c.executeRequest(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !c.canRetry(req) {
+		return resp, err
+	}
+
+	// The Zettelstore did not accept a token that the client believed valid,
+	// e.g. because the Zettelstore was restarted. Authenticate and retry once.
+	resp.Body.Close()
+	c.invalidateToken(req.Header.Get("Authorization"))
+	if err = c.updateToken(ctx); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(ctx)
+	retry.Header.Del("Authorization")
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return c.executeRequest(retry)
+}
+
+// canRetry returns true, if the request can be repeated after it was rejected
+// because of an invalid token.
+func (c *Client) canRetry(req *http.Request) bool {
+	if req.Header.Get("Authorization") == "" || (req.Body != nil && req.GetBody == nil) {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return c.retryAll
+}
+
+// invalidateToken removes the token, if it was used for the given
+// authorization header value.
+func (c *Client) invalidateToken(auth string) {
+	c.tokenMx.Lock()
+	if auth == c.tokenType+" "+c.token {
+		c.token = ""
+		c.tokenType = ""
+		c.expires = time.Time{}
+	}
+	c.tokenMx.Unlock()
+}
+
+// TokenInfo returns the type of the current access token, when it expires,
+// and whether it is believed to be valid.
+func (c *Client) TokenInfo() (typ string, expires time.Time, valid bool) {
+	c.tokenMx.RLock()
+	defer c.tokenMx.RUnlock()
+	return c.tokenType, c.expires, c.token != "" && time.Now().Before(c.expires)
+}
+
+// ForceAuthenticate discards the current access token and authenticates
+// again, e.g. after the Zettelstore was restarted.
+func (c *Client) ForceAuthenticate(ctx context.Context) error {
+	c.authMx.Lock()
+	defer c.authMx.Unlock()
+	c.clearToken()
+	return c.Authenticate(ctx)
 }
 
 // SetAuth sets authentication data.
 func (c *Client) SetAuth(username, password string) {
 	c.username = username
 	c.password = password
+	c.clearToken()
+}
+
+func (c *Client) clearToken() {
+	c.tokenMx.Lock()
 	c.token = ""
 	c.tokenType = ""
 	c.expires = time.Time{}
+	c.tokenMx.Unlock()
 }
 
 func (c *Client) executeAuthRequest(req *http.Request) error {
@@ -181,22 +560,40 @@ func (c *Client) executeAuthRequest(req *http.Request) error {
 	if len(token) < 4 {
 		return fmt.Errorf("no valid token found: %q", token)
 	}
+	c.tokenMx.Lock()
 	c.token = token
 	c.tokenType = vals[0].(sxpf.String).String()
 	c.expires = time.Now().Add(time.Duration(vals[2].(sxpf.Int64)*9/10) * time.Second)
+	c.tokenMx.Unlock()
 	return nil
 }
 
 func (c *Client) updateToken(ctx context.Context) error {
-	if c.username == "" {
+	if c.noAuth || c.username == "" {
 		return nil
 	}
-	if time.Now().After(c.expires) {
+	c.authMx.Lock()
+	defer c.authMx.Unlock()
+	c.tokenMx.RLock()
+	expires := c.expires
+	c.tokenMx.RUnlock()
+	if time.Now().After(expires) {
+		return c.Authenticate(ctx)
+	}
+	err := c.RefreshToken(ctx)
+	var cErr *Error
+	if errors.As(err, &cErr) && cErr.StatusCode == http.StatusUnauthorized {
+		// Token was invalidated by the Zettelstore.
+		c.clearToken()
 		return c.Authenticate(ctx)
 	}
-	return c.RefreshToken(ctx)
+	return err
 }
 
+// ErrAuthNotEnabled is returned by Authenticate, if the Zettelstore does not
+// support authentication.
+var ErrAuthNotEnabled = errors.New("authentication not enabled")
+
 // Authenticate sets a new token by sending user name and password.
 func (c *Client) Authenticate(ctx context.Context) error {
 	authData := url.Values{"username": {c.username}, "password": {c.password}}
@@ -205,7 +602,12 @@ func (c *Client) Authenticate(ctx context.Context) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	return c.executeAuthRequest(req)
+	err = c.executeAuthRequest(req)
+	var cErr *Error
+	if errors.As(err, &cErr) && (cErr.StatusCode == http.StatusNotFound || cErr.StatusCode == http.StatusBadRequest) {
+		return fmt.Errorf("%w: %w", ErrAuthNotEnabled, err)
+	}
+	return err
 }
 
 // RefreshToken updates the access token
@@ -238,13 +640,19 @@ func (c *Client) CreateZettel(ctx context.Context, data []byte) (api.ZettelID, e
 	return api.InvalidZID, err
 }
 
+// CreateZettelPlain creates a new zettel from the given metadata and content,
+// which are sent in the plain text format, see api.FormatZettel.
+func (c *Client) CreateZettelPlain(ctx context.Context, meta api.ZettelMeta, content []byte) (api.ZettelID, error) {
+	return c.CreateZettel(ctx, api.FormatZettel(meta, content))
+}
+
 // CreateZettelData creates a new zettel and returns its URL.
 func (c *Client) CreateZettelData(ctx context.Context, data api.ZettelData) (api.ZettelID, error) {
 	var buf bytes.Buffer
-	if err := encodeZettelData(&buf, &data); err != nil {
+	if err := c.encodeZettelData(&buf, &data); err != nil {
 		return api.InvalidZID, err
 	}
-	ub := c.newURLBuilder('z').AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson)
+	ub := c.newURLBuilder('z').WithEncoding(api.EncoderJson)
 	resp, err := c.buildAndExecuteRequest(ctx, http.MethodPost, ub, &buf, nil)
 	if err != nil {
 		return api.InvalidZID, err
@@ -265,7 +673,13 @@ func (c *Client) CreateZettelData(ctx context.Context, data api.ZettelData) (api
 	return api.InvalidZID, err
 }
 
-func encodeZettelData(buf *bytes.Buffer, data *api.ZettelData) error {
+func (c *Client) encodeZettelData(buf *bytes.Buffer, data *api.ZettelData) error {
+	if c.validate {
+		data.Canonicalize()
+		if errs := data.Validate(); len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+	}
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(false)
 	return enc.Encode(&data)
@@ -275,17 +689,15 @@ var bsLF = []byte{'\n'}
 
 // ListZettel returns a list of all Zettel.
 func (c *Client) ListZettel(ctx context.Context, query string) ([][]byte, error) {
-	ub := c.newURLBuilder('z').AppendQuery(query)
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	resp, err := c.Fetch(ctx, FetchRequest{Query: query})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusOK:
-	case http.StatusNoContent:
-	default:
-		return nil, statusToError(resp)
+	if ct := resp.ContentType; ct != "" {
+		if api.EncodingFromContentType(ct) != api.EncoderPlain {
+			return nil, fmt.Errorf("zettel list has content type %q, use ListZettelRaw to retrieve it", ct)
+		}
 	}
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -298,16 +710,31 @@ func (c *Client) ListZettel(ctx context.Context, query string) ([][]byte, error)
 	return lines, nil
 }
 
+// ListZettelRaw returns the unmodified response of a query, together with its
+// content type. This is needed for queries with an action that produces a
+// special format, e.g. "| RSS" or "| ATOM".
+func (c *Client) ListZettelRaw(ctx context.Context, query string) (string, []byte, error) {
+	resp, err := c.Fetch(ctx, FetchRequest{Query: query})
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.ContentType, data, nil
+}
+
 // ListZettelJSON returns a list of zettel.
 func (c *Client) ListZettelJSON(ctx context.Context, query string) (string, string, []api.ZidMetaJSON, error) {
-	ub := c.newURLBuilder('z').AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson).AppendQuery(query)
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	resp, err := c.Fetch(ctx, FetchRequest{Query: query, Encoding: api.EncoderJson})
 	if err != nil {
 		return "", "", nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", "", nil, statusToError(resp)
+	if err = resp.checkEncoding(api.EncoderJson); err != nil {
+		return "", "", nil, err
 	}
 	dec := json.NewDecoder(resp.Body)
 	var zl api.ZettelListJSON
@@ -320,34 +747,28 @@ func (c *Client) ListZettelJSON(ctx context.Context, query string) (string, stri
 
 // GetZettel returns a zettel as a string.
 func (c *Client) GetZettel(ctx context.Context, zid api.ZettelID, part string) ([]byte, error) {
-	ub := c.newURLBuilder('z').SetZid(zid)
-	if part != "" && part != api.PartContent {
-		ub.AppendKVQuery(api.QueryKeyPart, part)
-	}
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
-	if err != nil {
-		return nil, err
+	if part == api.PartContent {
+		part = ""
 	}
-	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusOK:
-	case http.StatusNoContent:
-	default:
-		return nil, statusToError(resp)
-	}
-	return io.ReadAll(resp.Body)
+	return c.fetchBytes(ctx, FetchRequest{Zid: zid, Part: part})
 }
 
 // GetZettelData returns a zettel as a struct of its parts.
 func (c *Client) GetZettelData(ctx context.Context, zid api.ZettelID) (api.ZettelData, error) {
-	ub := c.newURLBuilder('z').SetZid(zid)
-	ub.AppendKVQuery(api.QueryKeyEncoding, api.EncodingData)
-	ub.AppendKVQuery(api.QueryKeyPart, api.PartZettel)
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	return c.getZettelData(ctx, zid, ModeEvaluated)
+}
+
+// GetParsedZettelData returns a parsed zettel as a struct of its parts.
+func (c *Client) GetParsedZettelData(ctx context.Context, zid api.ZettelID) (api.ZettelData, error) {
+	return c.getZettelData(ctx, zid, ModeParsed)
+}
+
+func (c *Client) getZettelData(ctx context.Context, zid api.ZettelID, mode ParseMode) (api.ZettelData, error) {
+	resp, err := c.Fetch(ctx, FetchRequest{Zid: zid, Part: api.PartZettel, Encoding: api.EncoderData, ParseOnly: mode == ModeParsed})
 	if err == nil {
 		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return api.ZettelData{}, statusToError(resp)
+		if err = resp.checkEncoding(api.EncoderData); err != nil {
+			return api.ZettelData{}, err
 		}
 		rdr := reader.MakeReader(resp.Body)
 		obj, err2 := rdr.Read()
@@ -361,138 +782,132 @@ func (c *Client) GetZettelData(ctx context.Context, zid api.ZettelID) (api.Zette
 }
 
 func parseZettelSxToStruct(obj sxpf.Object, data *api.ZettelData) error {
-	vals, err := sx.ParseObject(obj, "yppppp")
+	zettel, err := sz.ParseDataZettel(obj)
 	if err != nil {
 		return err
 	}
-	if errSym := checkSymbol(vals[0], "zettel"); errSym != nil {
-		return errSym
+	data.Meta = zettel.Meta
+	data.Encoding = zettel.Encoding
+	data.Content = zettel.Content
+	return nil
+}
+func checkSymbol(obj sxpf.Object, exp string) error {
+	if got := obj.(*sxpf.Symbol).Name(); got != exp {
+		return fmt.Errorf("symbol %q expected, but got: %q", exp, got)
 	}
+	return nil
+}
 
-	// Ignore vals[1] (id "12345678901234"), we don't need it in ZettelData
-
-	meta, err := parseMetaSxToMap(vals[2].(*sxpf.Pair))
+// GetMetaData returns the metadata and the access rights of a zettel. In
+// contrast to GetMeta, it uses the data encoding.
+func (c *Client) GetMetaData(ctx context.Context, zid api.ZettelID) (api.ZettelMeta, api.ZettelRights, error) {
+	resp, err := c.Fetch(ctx, FetchRequest{Zid: zid, Part: api.PartMeta, Encoding: api.EncoderData})
 	if err != nil {
-		return err
+		return nil, api.ZettelCanNone, err
 	}
-
-	// Ignore vals[3] (rights 4), we don't need the rights in ZettelData
-
-	encVals, err := sx.ParseObject(vals[4], "ys")
-	if err != nil {
-		return err
+	defer resp.Body.Close()
+	if err = resp.checkEncoding(api.EncoderData); err != nil {
+		return nil, api.ZettelCanNone, err
 	}
-	if errSym := checkSymbol(encVals[0], "encoding"); errSym != nil {
-		return errSym
+	obj, err := reader.MakeReader(resp.Body).Read()
+	if err != nil {
+		return nil, api.ZettelCanNone, err
 	}
+	return parseMetaRightsSx(obj)
+}
 
-	contentVals, err := sx.ParseObject(vals[5], "ys")
+func parseMetaRightsSx(obj sxpf.Object) (api.ZettelMeta, api.ZettelRights, error) {
+	vals, err := sx.ParseObject(obj, "yoo")
 	if err != nil {
-		return err
+		return nil, api.ZettelCanNone, err
 	}
-	if errSym := checkSymbol(contentVals[0], "content"); errSym != nil {
-		return errSym
+	if errSym := checkSymbol(vals[0], "list"); errSym != nil {
+		return nil, api.ZettelCanNone, errSym
 	}
-
-	data.Meta = meta
-	data.Encoding = encVals[1].(sxpf.String).String()
-	data.Content = contentVals[1].(sxpf.String).String()
-	return nil
-}
-func checkSymbol(obj sxpf.Object, exp string) error {
-	if got := obj.(*sxpf.Symbol).Name(); got != exp {
-		return fmt.Errorf("symbol %q expected, but got: %q", exp, got)
+	meta, err := sz.ParseDataMeta(vals[1])
+	if err != nil {
+		return nil, api.ZettelCanNone, err
 	}
-	return nil
-}
-func parseMetaSxToMap(pair *sxpf.Pair) (api.ZettelMeta, error) {
-	if err := checkSymbol(pair.Car(), "meta"); err != nil {
-		return nil, err
+	rightsVals, err := sx.ParseObject(vals[2], "yi")
+	if err != nil {
+		return nil, api.ZettelCanNone, err
 	}
-	res := api.ZettelMeta{}
-	for node := pair.Tail(); node != nil; node = node.Tail() {
-		mVals, err := sx.ParseObject(node.Car(), "ys")
-		if err != nil {
-			return nil, err
-		}
-		res[mVals[0].(*sxpf.Symbol).Name()] = mVals[1].(sxpf.String).String()
+	if errSym := checkSymbol(rightsVals[0], "rights"); errSym != nil {
+		return nil, api.ZettelCanNone, errSym
 	}
-	return res, nil
+	return meta, api.ZettelRights(rightsVals[1].(sxpf.Int64)), nil
 }
 
+// ParseMode specifies whether a zettel is retrieved parsed or evaluated.
+type ParseMode int
+
+// Values for ParseMode.
+const (
+	ModeEvaluated ParseMode = iota // Zettel is parsed and evaluated
+	ModeParsed                     // Zettel is only parsed
+)
+
 // GetParsedZettel return a parsed zettel in a defined encoding.
 func (c *Client) GetParsedZettel(ctx context.Context, zid api.ZettelID, enc api.EncodingEnum) ([]byte, error) {
-	return c.getZettelString(ctx, zid, enc, true)
+	return c.GetEncodedZettel(ctx, zid, enc, ModeParsed)
 }
 
 // GetEvaluatedZettel return an evaluated zettel in a defined encoding.
 func (c *Client) GetEvaluatedZettel(ctx context.Context, zid api.ZettelID, enc api.EncodingEnum) ([]byte, error) {
-	return c.getZettelString(ctx, zid, enc, false)
+	return c.GetEncodedZettel(ctx, zid, enc, ModeEvaluated)
 }
 
-func (c *Client) getZettelString(ctx context.Context, zid api.ZettelID, enc api.EncodingEnum, parseOnly bool) ([]byte, error) {
-	ub := c.newURLBuilder('z').SetZid(zid)
-	ub.AppendKVQuery(api.QueryKeyEncoding, enc.String())
-	ub.AppendKVQuery(api.QueryKeyPart, api.PartContent)
-	if parseOnly {
-		ub.AppendKVQuery(api.QueryKeyParseOnly, "")
+// GetEncodedZettel returns the content of a zettel in a defined encoding,
+// parsed or evaluated as specified by the mode.
+func (c *Client) GetEncodedZettel(ctx context.Context, zid api.ZettelID, enc api.EncodingEnum, mode ParseMode) ([]byte, error) {
+	if api.Encoder(enc.String()) == api.EncoderUnknown {
+		return nil, fmt.Errorf("unknown encoding %v", enc)
 	}
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	return c.fetchBytes(ctx, FetchRequest{Zid: zid, Part: api.PartContent, Encoding: enc, ParseOnly: mode == ModeParsed})
+}
+
+func (c *Client) fetchBytes(ctx context.Context, fr FetchRequest) ([]byte, error) {
+	resp, err := c.Fetch(ctx, fr)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusOK:
-	case http.StatusNoContent:
-	default:
-		return nil, statusToError(resp)
-	}
 	return io.ReadAll(resp.Body)
 }
 
 // GetParsedSz returns an parsed zettel as a Sexpr-decoded data structure.
 func (c *Client) GetParsedSz(ctx context.Context, zid api.ZettelID, part string, sf sxpf.SymbolFactory) (sxpf.Object, error) {
-	return c.getSz(ctx, zid, part, true, sf)
+	return c.GetSz(ctx, zid, part, ModeParsed, sf)
 }
 
 // GetEvaluatedSz returns an evaluated zettel as a Sexpr-decoded data structure.
 func (c *Client) GetEvaluatedSz(ctx context.Context, zid api.ZettelID, part string, sf sxpf.SymbolFactory) (sxpf.Object, error) {
-	return c.getSz(ctx, zid, part, false, sf)
+	return c.GetSz(ctx, zid, part, ModeEvaluated, sf)
 }
 
-func (c *Client) getSz(ctx context.Context, zid api.ZettelID, part string, parseOnly bool, sf sxpf.SymbolFactory) (sxpf.Object, error) {
-	ub := c.newURLBuilder('z').SetZid(zid)
-	ub.AppendKVQuery(api.QueryKeyEncoding, api.EncodingSz)
-	if part != "" {
-		ub.AppendKVQuery(api.QueryKeyPart, part)
-	}
-	if parseOnly {
-		ub.AppendKVQuery(api.QueryKeyParseOnly, "")
-	}
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+// GetSz returns a zettel as a Sexpr-decoded data structure, parsed or
+// evaluated as specified by the mode.
+func (c *Client) GetSz(ctx context.Context, zid api.ZettelID, part string, mode ParseMode, sf sxpf.SymbolFactory) (sxpf.Object, error) {
+	resp, err := c.Fetch(ctx, FetchRequest{Zid: zid, Part: part, Encoding: api.EncoderSz, ParseOnly: mode == ModeParsed})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, statusToError(resp)
+	if err = resp.checkEncoding(api.EncoderSz); err != nil {
+		return nil, err
 	}
 	return reader.MakeReader(bufio.NewReaderSize(resp.Body, 8), reader.WithSymbolFactory(sf)).Read()
 }
 
 // GetMeta returns the metadata of a zettel.
 func (c *Client) GetMeta(ctx context.Context, zid api.ZettelID) (api.ZettelMeta, error) {
-	ub := c.newURLBuilder('z').SetZid(zid)
-	ub.AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson)
-	ub.AppendKVQuery(api.QueryKeyPart, api.PartMeta)
-	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	resp, err := c.Fetch(ctx, FetchRequest{Zid: zid, Part: api.PartMeta, Encoding: api.EncoderJson})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, statusToError(resp)
+	if err = resp.checkEncoding(api.EncoderJson); err != nil {
+		return nil, err
 	}
 	dec := json.NewDecoder(resp.Body)
 	var out api.MetaJSON
@@ -524,10 +939,11 @@ func (c *Client) GetZettelOrder(ctx context.Context, zid api.ZettelID) (*api.Zid
 	return &out, nil
 }
 
-// GetUnlinkedReferences returns connections to other zettel, embedded material, externals URLs.
-func (c *Client) GetUnlinkedReferences(
-	ctx context.Context, zid api.ZettelID, query url.Values) (*api.ZidMetaRelatedList, error) {
-	ub := c.newQueryURLBuilder('u', query).SetZid(zid)
+// GetZettelOrderData works like GetZettelOrder, but uses the data encoding.
+// The Zettelstore returns a list of the form
+// (order (id "...") (meta ...) (rights N) (list (zettel (id "...") (meta ...) (rights N)) ...)).
+func (c *Client) GetZettelOrderData(ctx context.Context, zid api.ZettelID) (*api.ZidMetaRelatedList, error) {
+	ub := c.newURLBuilder('o').SetZid(zid).WithEncoding(api.EncoderData)
 	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
 	if err != nil {
 		return nil, err
@@ -536,6 +952,114 @@ func (c *Client) GetUnlinkedReferences(
 	if resp.StatusCode != http.StatusOK {
 		return nil, statusToError(resp)
 	}
+	obj, err := reader.MakeReader(resp.Body).Read()
+	if err != nil {
+		return nil, err
+	}
+	return parseZidMetaRelatedSx(obj)
+}
+
+func parseZidMetaRelatedSx(obj sxpf.Object) (*api.ZidMetaRelatedList, error) {
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair || pair == nil {
+		return nil, fmt.Errorf("not a list: %v", obj)
+	}
+	zm, list, err := parseZidMetaFieldsSx(pair.Tail())
+	if err != nil {
+		return nil, err
+	}
+	result := api.ZidMetaRelatedList{ID: zm.ID, Meta: zm.Meta, Rights: zm.Rights}
+	for node := list; node != nil; node = node.Tail() {
+		item, isItemPair := sxpf.GetPair(node.Car())
+		if !isItemPair || item == nil {
+			return nil, fmt.Errorf("zettel list expected, but got: %v", node.Car())
+		}
+		if errSym := checkSymbol(item.Car(), "zettel"); errSym != nil {
+			return nil, errSym
+		}
+		itemZM, _, errItem := parseZidMetaFieldsSx(item.Tail())
+		if errItem != nil {
+			return nil, errItem
+		}
+		result.List = append(result.List, itemZM)
+	}
+	return &result, nil
+}
+
+// parseZidMetaFieldsSx parses a list of fields (id "..."), (meta ...),
+// (rights N), and (list ...). Unknown fields are ignored. The elements of the
+// list field are returned without further parsing.
+func parseZidMetaFieldsSx(fields *sxpf.Pair) (zm api.ZidMetaJSON, list *sxpf.Pair, err error) {
+	for node := fields; node != nil; node = node.Tail() {
+		field, isPair := sxpf.GetPair(node.Car())
+		if !isPair || field == nil {
+			return zm, nil, fmt.Errorf("field expected, but got: %v", node.Car())
+		}
+		sym, isSymbol := sxpf.GetSymbol(field.Car())
+		if !isSymbol {
+			return zm, nil, fmt.Errorf("field name expected, but got: %v", field.Car())
+		}
+		switch sym.Name() {
+		case "id":
+			vals, errVals := sx.ParseObject(field, "ys")
+			if errVals != nil {
+				return zm, nil, fmt.Errorf("id: %w", errVals)
+			}
+			zm.ID = api.ZettelID(vals[1].(sxpf.String).String())
+		case "meta":
+			if zm.Meta, err = sz.ParseDataMeta(field); err != nil {
+				return zm, nil, err
+			}
+		case "rights":
+			vals, errVals := sx.ParseObject(field, "yi")
+			if errVals != nil {
+				return zm, nil, fmt.Errorf("rights: %w", errVals)
+			}
+			zm.Rights = api.ZettelRights(vals[1].(sxpf.Int64))
+		case "list":
+			list = field.Tail()
+		}
+	}
+	if !zm.ID.IsValid() {
+		return zm, nil, fmt.Errorf("no valid zettel identifier: %q", zm.ID)
+	}
+	return zm, list, nil
+}
+
+// UnlinkedOptions controls the retrieval of unlinked references.
+type UnlinkedOptions struct {
+	// Phrase is searched for instead of the title of the zettel, if not empty.
+	Phrase string
+
+	// Limit is the maximum number of returned references. Zero means no limit.
+	Limit int
+}
+
+// GetUnlinkedReferences returns all zettel that mention the title of the given
+// zettel, or the phrase of the options, without linking to it. If the request
+// fails, but the Zettelstore sent the zettel itself, e.g. to report the access
+// rights of the current user, the zettel is returned together with the error.
+func (c *Client) GetUnlinkedReferences(
+	ctx context.Context, zid api.ZettelID, opts UnlinkedOptions) (*api.ZidMetaRelatedList, error) {
+	ub := c.newURLBuilder('u').SetZid(zid)
+	if opts.Phrase != "" {
+		ub.AppendKVQuery(api.QueryKeyPhrase, opts.Phrase)
+	}
+	if opts.Limit > 0 {
+		ub.AppendQuery(api.LimitDirective + " " + strconv.Itoa(opts.Limit))
+	}
+	return c.getUnlinkedReferences(ctx, ub)
+}
+
+func (c *Client) getUnlinkedReferences(ctx context.Context, ub *api.URLBuilder) (*api.ZidMetaRelatedList, error) {
+	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return unlinkedStatusToError(resp)
+	}
 	dec := json.NewDecoder(resp.Body)
 	var out api.ZidMetaRelatedList
 	err = dec.Decode(&out)
@@ -545,6 +1069,26 @@ func (c *Client) GetUnlinkedReferences(
 	return &out, nil
 }
 
+// unlinkedStatusToError returns the error of a failed request for unlinked
+// references. If the server sent the zettel, e.g. with its access rights, it
+// is returned too, but without references.
+func unlinkedStatusToError(resp *http.Response) (*api.ZidMetaRelatedList, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		body = nil
+	}
+	errResp := &Error{StatusCode: resp.StatusCode, Message: resp.Status[4:], Body: body}
+	if api.EncodingFromContentType(resp.Header.Get(api.HeaderContentType)) != api.EncoderJson {
+		return nil, errResp
+	}
+	var out api.ZidMetaRelatedList
+	if err = json.Unmarshal(body, &out); err != nil || out.ID == "" {
+		return nil, errResp
+	}
+	out.List = nil
+	return &out, errResp
+}
+
 // UpdateZettel updates an existing zettel.
 func (c *Client) UpdateZettel(ctx context.Context, zid api.ZettelID, data []byte) error {
 	ub := c.newURLBuilder('z').SetZid(zid)
@@ -562,10 +1106,10 @@ func (c *Client) UpdateZettel(ctx context.Context, zid api.ZettelID, data []byte
 // UpdateZettelData updates an existing zettel.
 func (c *Client) UpdateZettelData(ctx context.Context, zid api.ZettelID, data api.ZettelData) error {
 	var buf bytes.Buffer
-	if err := encodeZettelData(&buf, &data); err != nil {
+	if err := c.encodeZettelData(&buf, &data); err != nil {
 		return err
 	}
-	ub := c.newURLBuilder('z').SetZid(zid).AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson)
+	ub := c.newURLBuilder('z').SetZid(zid).WithEncoding(api.EncoderJson)
 	resp, err := c.buildAndExecuteRequest(ctx, http.MethodPut, ub, &buf, nil)
 	if err != nil {
 		return err
@@ -608,6 +1152,37 @@ func (c *Client) DeleteZettel(ctx context.Context, zid api.ZettelID) error {
 	return nil
 }
 
+// ErrHasIncomingLinks is returned by DeleteZettelChecked, if other zettel
+// still reference the zettel to be deleted.
+type ErrHasIncomingLinks struct {
+	Zid       api.ZettelID   // zettel that should be deleted
+	Referrers []api.ZettelID // zettel that reference it
+}
+
+func (err *ErrHasIncomingLinks) Error() string {
+	return fmt.Sprintf("zettel %v is referenced by %d other zettel", err.Zid, len(err.Referrers))
+}
+
+// DeleteZettelChecked deletes a zettel, but only if no other zettel references
+// it, or if force is true. Otherwise an error of type *ErrHasIncomingLinks is
+// returned.
+func (c *Client) DeleteZettelChecked(ctx context.Context, zid api.ZettelID, force bool) error {
+	if !force {
+		m, err := c.GetMeta(ctx, zid)
+		if err != nil {
+			return err
+		}
+		if backward := strings.Fields(m[api.KeyBackward]); len(backward) > 0 {
+			referrers := make([]api.ZettelID, len(backward))
+			for i, ref := range backward {
+				referrers[i] = api.ZettelID(ref)
+			}
+			return &ErrHasIncomingLinks{Zid: zid, Referrers: referrers}
+		}
+	}
+	return c.DeleteZettel(ctx, zid)
+}
+
 // ExecuteCommand will execute a given command at the Zettelstore.
 func (c *Client) ExecuteCommand(ctx context.Context, command api.Command) error {
 	ub := c.newURLBuilder('x').AppendKVQuery(api.QueryKeyCommand, string(command))
@@ -622,45 +1197,131 @@ func (c *Client) ExecuteCommand(ctx context.Context, command api.Command) error
 	return nil
 }
 
-func (c *Client) newQueryURLBuilder(key byte, query url.Values) *api.URLBuilder {
-	ub := c.newURLBuilder(key)
-	for key, values := range query {
-		if key == api.QueryKeyEncoding {
-			continue
-		}
-		for _, val := range values {
-			ub.AppendKVQuery(key, val)
-		}
-	}
-	return ub
-}
-
 // QueryMapMeta returns a map of all metadata values with the given query action to the
 // list of zettel IDs containing this value.
 func (c *Client) QueryMapMeta(ctx context.Context, query string) (api.MapMeta, error) {
-	err := c.updateToken(ctx)
+	result := api.MapMeta{}
+	err := c.QueryMapMetaFunc(ctx, query, func(key string, zids []api.ZettelID) error {
+		result[key] = zids
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	req, err := c.newRequest(ctx, http.MethodGet, c.newURLBuilder('z').AppendKVQuery(api.QueryKeyEncoding, api.EncodingJson).AppendQuery(query), nil)
+	return result, nil
+}
+
+// MapMetaFunc is called by QueryMapMetaFunc for every metadata value. If it
+// returns an error, the query is stopped and the error is returned.
+type MapMetaFunc func(key string, zids []api.ZettelID) error
+
+// MapMetaOption configures QueryMapMetaFunc.
+type MapMetaOption func(*mapMetaConfig)
+
+type mapMetaConfig struct {
+	key    string
+	prefix string
+}
+
+// WithValuePrefix restricts the result to values of the given metadata key
+// that start with the given prefix. The Zettelstore is asked only for zettel
+// containing such a value, other values of these zettel are skipped.
+func WithValuePrefix(key, prefix string) MapMetaOption {
+	return func(cfg *mapMetaConfig) {
+		cfg.key = key
+		cfg.prefix = prefix
+	}
+}
+
+// QueryMapMetaFunc works like QueryMapMeta, but decodes the map incrementally
+// and calls the given function for every metadata value. It is intended for
+// huge maps, e.g. tag clouds of large Zettelstores.
+func (c *Client) QueryMapMetaFunc(ctx context.Context, query string, fn MapMetaFunc, opts ...MapMetaOption) error {
+	var cfg mapMetaConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.key != "" && cfg.prefix != "" {
+		query = cfg.key + api.SearchOperatorPrefix + api.QueryEscapeValue(cfg.prefix) + " " + query
+	}
+	err := c.updateToken(ctx)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, c.newURLBuilder('z').WithEncoding(api.EncoderJson).AppendQuery(query), nil)
+	if err != nil {
+		return err
 	}
 	resp, err := c.executeRequest(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, statusToError(resp)
+		return queryStatusToError(resp, query)
 	}
-	dec := json.NewDecoder(resp.Body)
-	var mlj api.MapListJSON
-	err = dec.Decode(&mlj)
+	if cfg.prefix != "" {
+		prefixFn := fn
+		fn = func(key string, zids []api.ZettelID) error {
+			if strings.HasPrefix(key, cfg.prefix) {
+				return prefixFn(key, zids)
+			}
+			return nil
+		}
+	}
+	return decodeMapMeta(json.NewDecoder(resp.Body), fn)
+}
+
+// decodeMapMeta decodes an api.MapListJSON value, element by element.
+func decodeMapMeta(dec *json.Decoder, fn MapMetaFunc) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != "map" {
+			var ignore json.RawMessage
+			if err = dec.Decode(&ignore); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			tok, err = dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			var zids []api.ZettelID
+			if err = dec.Decode(&zids); err != nil {
+				return err
+			}
+			if err = fn(key, zids); err != nil {
+				return err
+			}
+		}
+		if err = expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, but got %v", delim, tok)
 	}
-	return mlj.Map, nil
+	return nil
 }
 
 // GetVersionInfo returns version information..
@@ -675,18 +1336,32 @@ func (c *Client) GetVersionInfo(ctx context.Context) (VersionInfo, error) {
 	}
 	rdr := reader.MakeReader(resp.Body)
 	obj, err := rdr.Read()
-	if err == nil {
-		if vals, errVals := sx.ParseObject(obj, "iiiss"); errVals == nil {
-			return VersionInfo{
-				Major: int(vals[0].(sxpf.Int64)),
-				Minor: int(vals[1].(sxpf.Int64)),
-				Patch: int(vals[2].(sxpf.Int64)),
-				Info:  vals[3].(sxpf.String).String(),
-				Hash:  vals[4].(sxpf.String).String(),
-			}, nil
-		}
+	if err != nil {
+		return VersionInfo{}, err
 	}
-	return VersionInfo{}, err
+	return parseVersionInfo(obj)
+}
+
+// parseVersionInfo parses the version s-expression. Older Zettelstore
+// releases send only the three version numbers.
+func parseVersionInfo(obj sxpf.Object) (VersionInfo, error) {
+	vals, err := sx.ParseObject(obj, "iiiss")
+	if errors.Is(err, sx.ErrElementsMissing) {
+		vals, err = sx.ParseObject(obj, "iii")
+	}
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("version: %w", err)
+	}
+	vi := VersionInfo{
+		Major: int(vals[0].(sxpf.Int64)),
+		Minor: int(vals[1].(sxpf.Int64)),
+		Patch: int(vals[2].(sxpf.Int64)),
+	}
+	if len(vals) > 3 {
+		vi.Info = vals[3].(sxpf.String).String()
+		vi.Hash = vals[4].(sxpf.String).String()
+	}
+	return vi, nil
 }
 
 // VersionInfo contains version information.
@@ -697,3 +1372,36 @@ type VersionInfo struct {
 	Info  string
 	Hash  string
 }
+
+// String returns the version in the form "major.minor.patch-info+hash".
+// Info and hash are omitted, if they are empty.
+func (vi VersionInfo) String() string {
+	s := fmt.Sprintf("%d.%d.%d", vi.Major, vi.Minor, vi.Patch)
+	if vi.Info != "" {
+		s += "-" + vi.Info
+	}
+	if vi.Hash != "" {
+		s += "+" + vi.Hash
+	}
+	return s
+}
+
+// Compare returns -1, 0, or +1, depending on whether the version number is
+// less than, equal to, or greater than the other version number. Info and
+// hash are not compared.
+func (vi VersionInfo) Compare(other VersionInfo) int {
+	for _, d := range []int{vi.Major - other.Major, vi.Minor - other.Minor, vi.Patch - other.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast returns true, if the version number is not less than the given one.
+func (vi VersionInfo) AtLeast(major, minor, patch int) bool {
+	return vi.Compare(VersionInfo{Major: major, Minor: minor, Patch: patch}) >= 0
+}
@@ -11,11 +11,22 @@
 package client_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"zettelstore.de/c/api"
 	"zettelstore.de/c/client"
@@ -60,6 +71,1192 @@ func TestGetSzZettel(t *testing.T) {
 	}
 }
 
+func TestSlowRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		switch r.URL.Path {
+		case "/a":
+			w.Write([]byte(`("Bearer" "abcdefgh" 600)`))
+		case "/x":
+			w.Write([]byte(`(0 12 0 "" "hash")`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	c.SetAuth("user", "secret")
+	var got []string
+	c.SetSlowRequestThreshold(10*time.Millisecond, func(method, u string, d time.Duration) {
+		if d < 10*time.Millisecond {
+			t.Errorf("duration %v is below threshold", d)
+		}
+		got = append(got, method+" "+strings.TrimPrefix(u, srv.URL))
+	})
+	if _, err := c.GetVersionInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListZettel(context.Background(), "password:secret"); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"POST /a", "GET /x", "PUT /a", "GET /z"}
+	if strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Errorf("expected slow requests %v, but got %v", exp, got)
+	}
+
+	got = nil
+	c.SetSlowRequestThreshold(time.Hour, nil)
+	if _, err := c.GetVersionInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("no slow requests expected, but got %v", got)
+	}
+}
+
+func TestCreateWithValidation(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"20230101000000"}`))
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL, client.WithValidation())
+	data := api.ZettelData{Meta: api.ZettelMeta{"Title": "T", "tags": "a", "modified": "20230101000000"}}
+	if _, err := c.CreateZettelData(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"meta":{"tags":"#a","title":"T"},"encoding":"","content":""}` + "\n"
+	if string(body) != exp {
+		t.Errorf("expected body %q, but got %q", exp, body)
+	}
+
+	body = nil
+	data = api.ZettelData{Meta: api.ZettelMeta{"precursor": "123"}}
+	if _, err := c.CreateZettelData(context.Background(), data); err == nil {
+		t.Error("error expected")
+	}
+	if body != nil {
+		t.Error("invalid data must not be sent")
+	}
+}
+
+func TestCreateZettelPlain(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "20230101000000")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	meta := api.ZettelMeta{api.KeyTitle: "T", api.KeySummary: "a\nb"}
+	zid, err := c.CreateZettelPlain(context.Background(), meta, []byte("Content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zid != "20230101000000" {
+		t.Errorf("unexpected zettel identifier %q", zid)
+	}
+	if exp := "title: T\nsummary: a\n b\n\nContent"; string(body) != exp {
+		t.Errorf("expected body %q, but got %q", exp, body)
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has(api.QueryKeyQuery) {
+			w.Header().Add(api.HeaderWarning, `299 - "deprecated search syntax"`)
+			w.Header().Add(api.HeaderWarning, `299 - "another warning"`)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	var warnings []string
+	c.SetWarningHandler(func(s string) { warnings = append(warnings, s) })
+	if _, err := c.ListZettel(context.Background(), "old"); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{`299 - "deprecated search syntax"`, `299 - "another warning"`}
+	if strings.Join(warnings, "|") != strings.Join(exp, "|") {
+		t.Errorf("expected warnings %v, but got %v", exp, warnings)
+	}
+	warnings = nil
+	if _, err := c.GetZettel(context.Background(), api.ZidDefaultHome, api.PartContent); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("no warnings expected, but got %v", warnings)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "9") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			zid := api.ZidDefaultHome
+			if i%4 == 0 {
+				zid = api.ZettelID("20230101000009")
+			}
+			c.GetZettel(context.Background(), zid, api.PartContent)
+		}(i)
+	}
+	wg.Wait()
+	c.DeleteZettel(context.Background(), api.ZidDefaultHome)
+
+	snapshot := c.MetricsSnapshot()
+	if len(snapshot) != 2 {
+		t.Errorf("expected two entries, but got %v", snapshot)
+	}
+	get := snapshot["GET z"]
+	if get.Count != n || get.Errors != n/4 {
+		t.Errorf("expected %d calls with %d errors, but got %d/%d", n, n/4, get.Count, get.Errors)
+	}
+	if get.MaxDuration <= 0 || get.TotalDuration < get.MaxDuration {
+		t.Errorf("invalid durations: total=%v, max=%v", get.TotalDuration, get.MaxDuration)
+	}
+	if del := snapshot["DELETE z"]; del.Count != 1 || del.Errors != 0 {
+		t.Errorf("expected one successful delete, but got %v", del)
+	}
+
+	c.ResetMetrics()
+	if snapshot = c.MetricsSnapshot(); len(snapshot) != 0 {
+		t.Errorf("metrics not reset: %v", snapshot)
+	}
+}
+
+func TestDeleteZettelChecked(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			backward := ""
+			if strings.HasSuffix(r.URL.Path, string(api.ZidDefaultHome)) {
+				backward = "20230101000000 20230102000000"
+			}
+			w.Header().Set(api.HeaderContentType, "application/json")
+			io.WriteString(w, `{"meta":{"title":"T","backward":"`+backward+`"},"rights":2}`)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	err := c.DeleteZettelChecked(ctx, api.ZidDefaultHome, false)
+	var linkErr *client.ErrHasIncomingLinks
+	if !errors.As(err, &linkErr) {
+		t.Fatalf("expected ErrHasIncomingLinks, but got %v", err)
+	}
+	if linkErr.Zid != api.ZidDefaultHome || len(linkErr.Referrers) != 2 || linkErr.Referrers[1] != "20230102000000" {
+		t.Errorf("unexpected error data: %+v", linkErr)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("zettel must not be deleted: %v", deleted)
+	}
+
+	if err = c.DeleteZettelChecked(ctx, api.ZidDefaultHome, true); err != nil {
+		t.Error(err)
+	}
+	if err = c.DeleteZettelChecked(ctx, "20230103000000", false); err != nil {
+		t.Error(err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("expected two deletions, but got %v", deleted)
+	}
+}
+
+func TestListZettelRaw(t *testing.T) {
+	const rss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Zettelstore</title></channel></rss>
+`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Query().Get(api.QueryKeyQuery), "| RSS") {
+			w.Header().Set(api.HeaderContentType, "application/rss+xml")
+			io.WriteString(w, rss)
+			return
+		}
+		w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+		io.WriteString(w, "20230101000000 Zettel 1\n20230102000000 Zettel 2\n")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	ct, body, err := c.ListZettelRaw(ctx, "title:a | RSS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct != "application/rss+xml" || string(body) != rss {
+		t.Errorf("unexpected result %q: %q", ct, body)
+	}
+	if _, err = c.ListZettel(ctx, "title:a | RSS"); err == nil || !strings.Contains(err.Error(), "ListZettelRaw") {
+		t.Errorf("expected error that points to ListZettelRaw, but got %v", err)
+	}
+	lines, err := c.ListZettel(ctx, "title:a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Errorf("expected two lines, but got %q", lines)
+	}
+}
+
+func TestGetMetaData(t *testing.T) {
+	const body = `(list (meta (title "A title") (role "zettel") (tags "#a #b") (back "20230101000000 20230102000000") (author "me")) (rights 6))`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get(api.QueryKeyEncoding) != api.EncodingData || q.Get(api.QueryKeyPart) != api.PartMeta {
+			http.Error(w, "wrong query", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	m, rights, err := c.GetMetaData(context.Background(), api.ZidDefaultHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := api.ZettelMeta{
+		api.KeyTitle:  "A title",
+		api.KeyRole:   "zettel",
+		api.KeyTags:   "#a #b",
+		api.KeyBack:   "20230101000000 20230102000000",
+		api.KeyAuthor: "me",
+	}
+	if len(m) != len(exp) {
+		t.Errorf("expected %v, but got %v", exp, m)
+	}
+	for k, v := range exp {
+		if got := m[k]; got != v {
+			t.Errorf("key %q: expected %q, but got %q", k, v, got)
+		}
+	}
+	if rights != api.ZettelCanRead|api.ZettelCanCreate {
+		t.Errorf("expected rights 6, but got %v", rights)
+	}
+}
+
+func TestDefaultHeader(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	if err := c.SetDefaultHeader("authorization", "Bearer x"); !errors.Is(err, client.ErrAuthorizationHeader) {
+		t.Errorf("expected ErrAuthorizationHeader, but got %v", err)
+	}
+	if err := c.SetDefaultHeader("accept-language", "de"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDefaultHeader("X-Test", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ListZettel(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if al, xt := got.Get("Accept-Language"), got.Get("X-Test"); al != "de" || xt != "1" {
+		t.Errorf("default headers not sent: %v", got)
+	}
+	if auth := got.Get("Authorization"); auth != "" {
+		t.Errorf("no authorization expected, but got %q", auth)
+	}
+
+	// A header given by the request wins over the default header.
+	if err := c.SetDefaultHeader(api.HeaderDestination, "/z/00000000000000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RenameZettel(ctx, api.ZidDefaultHome, "20230101000000"); err != nil {
+		t.Fatal(err)
+	}
+	if dest := got.Values(api.HeaderDestination); len(dest) != 1 || !strings.HasSuffix(dest[0], "/z/20230101000000") {
+		t.Errorf("expected destination header of request, but got %v", dest)
+	}
+
+	if err := c.SetDefaultHeader("X-Test", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListZettel(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if xt := got.Values("X-Test"); len(xt) != 0 {
+		t.Errorf("removed default header was sent: %v", xt)
+	}
+}
+
+func TestAuthNotEnabled(t *testing.T) {
+	authCalls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			authCalls++
+			http.NotFound(w, r)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("no authorization expected, but got %q", auth)
+		}
+		w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := newTestClient(srv.URL)
+	c.SetAuth("user", "secret")
+	if err := c.Authenticate(ctx); !errors.Is(err, client.ErrAuthNotEnabled) {
+		t.Errorf("expected ErrAuthNotEnabled, but got %v", err)
+	}
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent); !errors.Is(err, client.ErrAuthNotEnabled) {
+		t.Errorf("expected ErrAuthNotEnabled for GetZettel, but got %v", err)
+	}
+	if authCalls != 2 {
+		t.Errorf("expected 2 authentication requests, but got %d", authCalls)
+	}
+
+	authCalls = 0
+	c = newTestClient(srv.URL, client.WithNoAuth())
+	c.SetAuth("user", "secret")
+	data, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Errorf("expected content, but got %q", data)
+	}
+	if authCalls != 0 {
+		t.Errorf("no authentication request expected, but got %d", authCalls)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+			io.WriteString(w, "login")
+			return
+		}
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := newTestClient(srv.URL)
+	_, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent)
+	var rErr *client.RedirectError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("expected RedirectError, but got %v", err)
+	}
+	if exp := srv.URL + "/login"; rErr.Location != exp {
+		t.Errorf("expected location %q, but got %q", exp, rErr.Location)
+	}
+	if exp := srv.URL + "/z/" + string(api.ZidDefaultHome); len(rErr.Via) != 1 || rErr.Via[0] != exp {
+		t.Errorf("expected redirect from %q, but got %v", exp, rErr.Via)
+	}
+
+	c = newTestClient(srv.URL, client.WithFollowRedirects())
+	data, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "login" {
+		t.Errorf("expected redirected content, but got %q", data)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat("title: Large\n\nSome content. ", 200)
+	var gotBody, gotEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			gotEncoding = r.Header.Get("Content-Encoding")
+			body := io.Reader(r.Body)
+			if gotEncoding == "gzip" {
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				body = zr
+			}
+			data, _ := io.ReadAll(body)
+			gotBody = string(data)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if ae := r.Header.Get("Accept-Encoding"); ae != "gzip" {
+			t.Errorf("expected gzip encoding to be accepted, but got %q", ae)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Query().Has(api.QueryKeyEncoding) {
+			w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+		}
+		zw := gzip.NewWriter(w)
+		if r.URL.Query().Get(api.QueryKeyEncoding) == api.EncodingSz {
+			io.WriteString(zw, `(BLOCK (PARA (TEXT "compressed")))`)
+		} else {
+			io.WriteString(zw, large)
+		}
+		zw.Close()
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL, client.WithCompression())
+	ctx := context.Background()
+
+	if err := c.UpdateZettel(ctx, api.ZidDefaultHome, []byte(large)); err != nil {
+		t.Fatal(err)
+	}
+	if gotEncoding != "gzip" || gotBody != large {
+		t.Errorf("large body not compressed correctly: %q, %d bytes", gotEncoding, len(gotBody))
+	}
+	if err := c.UpdateZettel(ctx, api.ZidDefaultHome, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	if gotEncoding != "" || gotBody != "small" {
+		t.Errorf("small body must not be compressed: %q, %q", gotEncoding, gotBody)
+	}
+
+	data, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartZettel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != large {
+		t.Errorf("response not decompressed, got %d bytes", len(data))
+	}
+	obj, err := c.GetEvaluatedSz(ctx, api.ZidDefaultHome, api.PartContent, sxpf.MakeMappedFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := obj.String(); got != `(BLOCK (PARA (TEXT "compressed")))` {
+		t.Errorf("streamed response not decompressed, got %s", got)
+	}
+}
+
+func TestTokenInvalidation(t *testing.T) {
+	var mx sync.Mutex
+	issued, valid, refreshValid := 0, "", true
+	var zettelCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		auth := r.Header.Get("Authorization")
+		if r.URL.Path == "/a" {
+			if r.Method == http.MethodPut {
+				// Refresh returns the presented token, if refreshing is possible.
+				if !refreshValid {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				io.WriteString(w, `("Bearer" "`+strings.TrimPrefix(auth, "Bearer ")+`" 600)`)
+				return
+			}
+			issued++
+			valid = "token" + strconv.Itoa(issued)
+			io.WriteString(w, `("Bearer" "`+valid+`" 600)`)
+			return
+		}
+		zettelCalls++
+		if auth != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "20230704120102")
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	invalidate := func(refresh bool) {
+		mx.Lock()
+		valid, refreshValid = "invalid", refresh
+		zettelCalls = 0
+		mx.Unlock()
+	}
+
+	c := newTestClient(srv.URL)
+	if typ, _, ok := c.TokenInfo(); typ != "" || ok {
+		t.Errorf("no token expected, but got %q/%v", typ, ok)
+	}
+	c.SetAuth("user", "secret")
+	if err := c.ForceAuthenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if typ, expires, ok := c.TokenInfo(); typ != "Bearer" || !ok || time.Until(expires) < 500*time.Second {
+		t.Errorf("valid token expected, but got %q/%v/%v", typ, expires, ok)
+	}
+
+	// Server invalidated token, but refresh is still accepted: retry the request.
+	invalidate(true)
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent); err != nil {
+		t.Fatal(err)
+	}
+	if zettelCalls != 2 || valid != "token2" {
+		t.Errorf("expected retry with new token, but got %d calls, token %q", zettelCalls, valid)
+	}
+
+	// Server invalidated token, refresh fails: authenticate again.
+	invalidate(false)
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent); err != nil {
+		t.Fatal(err)
+	}
+	if zettelCalls != 1 || valid != "token3" {
+		t.Errorf("expected new authentication, but got %d calls, token %q", zettelCalls, valid)
+	}
+
+	// Non-idempotent requests are not retried by default.
+	invalidate(true)
+	var cErr *client.Error
+	if _, err := c.CreateZettel(ctx, []byte("title: T\n\ncontent")); !errors.As(err, &cErr) || cErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized error, but got %v", err)
+	}
+	if zettelCalls != 1 {
+		t.Errorf("no retry expected, but got %d calls", zettelCalls)
+	}
+
+	c = newTestClient(srv.URL, client.WithRetryNonIdempotent())
+	c.SetAuth("user", "secret")
+	if err := c.ForceAuthenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	invalidate(true)
+	if _, err := c.CreateZettel(ctx, []byte("title: T\n\ncontent")); err != nil {
+		t.Fatal(err)
+	}
+	if zettelCalls != 2 {
+		t.Errorf("expected retry, but got %d calls", zettelCalls)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL, client.WithDefaultTimeout(100*time.Millisecond))
+
+	// The default timeout applies to reading the body, too.
+	if _, err := c.GetZettel(context.Background(), api.ZidDefaultHome, api.PartContent); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, but got %v", err)
+	}
+
+	// A deadline of the context replaces the default timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	data, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Errorf("expected content, but got %q", data)
+	}
+}
+
+func TestContextErrors(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL, client.WithDefaultTimeout(100*time.Millisecond))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent)
+	if !client.IsCanceled(err) || client.IsTimeout(err) {
+		t.Errorf("expected canceled error, but got %v", err)
+	}
+
+	_, err = c.GetZettel(context.Background(), api.ZidDefaultHome, api.PartContent)
+	<-started
+	if !client.IsTimeout(err) || client.IsCanceled(err) {
+		t.Errorf("expected timeout error, but got %v", err)
+	}
+
+	get := c.MetricsSnapshot()["GET z"]
+	if get.Count != 2 || get.Errors != 2 || get.Canceled != 1 || get.Timeouts != 1 {
+		t.Errorf("unexpected metrics: %+v", get)
+	}
+	if client.IsCanceled(nil) || client.IsTimeout(nil) || client.IsTimeout(io.EOF) {
+		t.Error("non-context errors must not be classified")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	agents := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents[r.Method+" "+r.URL.Path] = r.Header.Get("User-Agent")
+		if r.URL.Path == "/a" {
+			io.WriteString(w, `("Bearer" "token" 600)`)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent); err != nil {
+		t.Fatal(err)
+	}
+	exp := "zettelstore-client-go/" + client.Version
+	if got := agents["GET /z/00010000000000"]; got != exp {
+		t.Errorf("expected user agent %q, but got %q", exp, got)
+	}
+
+	c.SetAuth("user", "secret")
+	c.SetUserAgent("myapp/1.0")
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartContent); err != nil {
+		t.Fatal(err)
+	}
+	exp += " myapp/1.0"
+	for _, key := range []string{"POST /a", "GET /z/00010000000000"} {
+		if got := agents[key]; got != exp {
+			t.Errorf("%s: expected user agent %q, but got %q", key, exp, got)
+		}
+	}
+}
+
+func TestURLs(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, "http://"+r.Host+r.URL.RequestURI())
+		io.WriteString(w, "content")
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, api.PartZettel); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListZettel(ctx, "title:a b"); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		c.ZettelURL(api.ZidDefaultHome, url.Values{api.QueryKeyPart: {api.PartZettel}}),
+		c.ListURL("title:a b"),
+	}
+	if len(requested) != len(exp) {
+		t.Fatalf("expected %d requests, but got %v", len(exp), requested)
+	}
+	for i, u := range exp {
+		if requested[i] != u {
+			t.Errorf("%d: expected URL %q, but got %q", i, requested[i], u)
+		}
+	}
+
+	got := c.ZettelURL(api.ZidDefaultHome, url.Values{"b": {"2"}, "a": {"1", "x y"}})
+	if exp := srv.URL + "/z/00010000000000?a=1&a=x+y&b=2"; got != exp {
+		t.Errorf("expected URL %q, but got %q", exp, got)
+	}
+}
+
+func TestGetVersionInfo(t *testing.T) {
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, response)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	testcases := []struct {
+		response string
+		exp      string
+	}{
+		{`(0 12 1 "dev" "abc123")`, "0.12.1-dev+abc123"},
+		{`(0 12 0 "" "abc123")`, "0.12.0+abc123"},
+		{`(0 11 2)`, "0.11.2"},
+	}
+	for _, tc := range testcases {
+		response = tc.response
+		vi, err := c.GetVersionInfo(ctx)
+		if err != nil {
+			t.Errorf("%s: %v", tc.response, err)
+			continue
+		}
+		if got := vi.String(); got != tc.exp {
+			t.Errorf("%s: expected %q, but got %q", tc.response, tc.exp, got)
+		}
+	}
+	for _, resp := range []string{`(0 12)`, `(0 "12" 1)`, `(0 12 1 "dev")`, `0`} {
+		response = resp
+		if vi, err := c.GetVersionInfo(ctx); err == nil {
+			t.Errorf("%s: error expected, but got %v", resp, vi)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	vi := client.VersionInfo{Major: 0, Minor: 12, Patch: 1, Hash: "abc"}
+	testcases := []struct {
+		other client.VersionInfo
+		exp   int
+	}{
+		{client.VersionInfo{Major: 0, Minor: 12, Patch: 1}, 0},
+		{client.VersionInfo{Major: 0, Minor: 12, Patch: 2}, -1},
+		{client.VersionInfo{Major: 0, Minor: 11, Patch: 9}, 1},
+		{client.VersionInfo{Major: 1}, -1},
+	}
+	for _, tc := range testcases {
+		if got := vi.Compare(tc.other); got != tc.exp {
+			t.Errorf("%v.Compare(%v): expected %d, but got %d", vi, tc.other, tc.exp, got)
+		}
+		if got := tc.other.Compare(vi); got != -tc.exp {
+			t.Errorf("%v.Compare(%v): expected %d, but got %d", tc.other, vi, -tc.exp, got)
+		}
+	}
+	if !vi.AtLeast(0, 12, 0) || !vi.AtLeast(0, 12, 1) || vi.AtLeast(0, 12, 2) || vi.AtLeast(1, 0, 0) {
+		t.Errorf("AtLeast fails for %v", vi)
+	}
+}
+
+func TestInvalidPartEncoding(t *testing.T) {
+	c := newTestClient("http://invalid.example")
+	ctx := context.Background()
+	if _, err := c.GetZettel(ctx, api.ZidDefaultHome, "all"); err == nil {
+		t.Error("GetZettel: error expected for invalid part")
+	}
+	if _, err := c.GetParsedSz(ctx, api.ZidDefaultHome, "all", nil); err == nil {
+		t.Error("GetParsedSz: error expected for invalid part")
+	}
+	if _, err := c.GetEvaluatedZettel(ctx, api.ZidDefaultHome, api.EncoderUnknown); err == nil {
+		t.Error("GetEvaluatedZettel: error expected for unknown encoding")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	var parseOnly []bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parseOnly = append(parseOnly, r.URL.Query().Has(api.QueryKeyParseOnly))
+		switch r.URL.Query().Get(api.QueryKeyEncoding) {
+		case api.EncodingData:
+			io.WriteString(w, `(zettel (id "20230101000000") (meta (title "T")) (rights 6) (encoding "") (content "c"))`)
+		case api.EncodingSz:
+			io.WriteString(w, `(BLOCK)`)
+		default:
+			io.WriteString(w, "content")
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+	zid := api.ZettelID("20230101000000")
+
+	for _, mode := range []client.ParseMode{client.ModeEvaluated, client.ModeParsed} {
+		parseOnly = nil
+		if _, err := c.GetEncodedZettel(ctx, zid, api.EncoderHTML, mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.GetSz(ctx, zid, api.PartContent, mode, nil); err != nil {
+			t.Fatal(err)
+		}
+		exp := mode == client.ModeParsed
+		for i, got := range parseOnly {
+			if got != exp {
+				t.Errorf("mode %d, request %d: expected parseonly %v, but got %v", mode, i, exp, got)
+			}
+		}
+	}
+
+	parseOnly = nil
+	if _, err := c.GetEvaluatedZettel(ctx, zid, api.EncoderText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetParsedZettel(ctx, zid, api.EncoderText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetZettelData(ctx, zid); err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.GetParsedZettelData(ctx, zid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Meta[api.KeyTitle] != "T" || data.Content != "c" {
+		t.Errorf("unexpected zettel data: %v", data)
+	}
+	if exp := []bool{false, true, false, true}; fmt.Sprint(parseOnly) != fmt.Sprint(exp) {
+		t.Errorf("expected parseonly %v, but got %v", exp, parseOnly)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.RequestURI())
+		switch r.URL.Query().Get(api.QueryKeyEncoding) {
+		case api.EncodingZMK:
+			w.Header().Set(api.HeaderContentType, "text/plain; charset=utf-8")
+			io.WriteString(w, "title: Home")
+		case api.EncodingText:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	resp, err := c.Fetch(ctx, client.FetchRequest{
+		Zid:       api.ZidDefaultHome,
+		Part:      api.PartMeta,
+		Encoding:  api.EncoderZmk,
+		ParseOnly: true,
+		Extra:     url.Values{"b": {"2"}, "a": {"1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.ContentType != "text/plain; charset=utf-8" || string(data) != "title: Home" {
+		t.Errorf("unexpected response %d %q %q", resp.StatusCode, resp.ContentType, data)
+	}
+
+	resp, err = c.Fetch(ctx, client.FetchRequest{Query: "role:zettel", Encoding: api.EncoderText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, but got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	_, err = c.Fetch(ctx, client.FetchRequest{Zid: api.ZidDefaultHome, Encoding: api.EncoderSz})
+	var cErr *client.Error
+	if !errors.As(err, &cErr) || cErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, but got %v", err)
+	}
+
+	exp := []string{
+		"/z/00010000000000?enc=zmk&part=meta&parseonly&a=1&b=2",
+		"/z?enc=text&q=role%3Azettel",
+		"/z/00010000000000?enc=sz",
+	}
+	if len(requested) != len(exp) {
+		t.Fatalf("expected %d requests, but got %v", len(exp), requested)
+	}
+	for i, u := range exp {
+		if requested[i] != u {
+			t.Errorf("%d: expected URL %q, but got %q", i, u, requested[i])
+		}
+	}
+
+	for _, fr := range []client.FetchRequest{
+		{Zid: api.ZidDefaultHome, Query: "role:zettel"},
+		{Zid: api.ZidDefaultHome, Part: "all"},
+		{Zid: api.ZidDefaultHome, Encoding: api.EncodingEnum(200)},
+		{Query: "role:zettel", Extra: url.Values{api.QueryKeyQuery: {"tags:#a"}}},
+	} {
+		if _, err = c.Fetch(ctx, fr); err == nil {
+			t.Errorf("error expected for %v", fr)
+		}
+	}
+	if len(requested) != len(exp) {
+		t.Errorf("invalid requests were sent: %v", requested[len(exp):])
+	}
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("Proxy error. ", 30) + "</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(api.HeaderContentType, api.ContentTypeHTML)
+		io.WriteString(w, page)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"GetEvaluatedSz": func() error {
+			_, err := c.GetEvaluatedSz(ctx, api.ZidDefaultHome, api.PartContent, nil)
+			return err
+		},
+		"GetZettelData": func() error {
+			_, err := c.GetZettelData(ctx, api.ZidDefaultHome)
+			return err
+		},
+		"ListZettelJSON": func() error {
+			_, _, _, err := c.ListZettelJSON(ctx, "")
+			return err
+		},
+		"GetMeta": func() error {
+			_, err := c.GetMeta(ctx, api.ZidDefaultHome)
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		var ctErr *client.ErrUnexpectedContentType
+		if !errors.As(err, &ctErr) {
+			t.Errorf("%s: expected content type error, but got %v", name, err)
+			continue
+		}
+		if ctErr.ContentType != api.ContentTypeHTML || string(ctErr.Body) != page[:200] {
+			t.Errorf("%s: unexpected error content: %v", name, ctErr)
+		}
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	msg := "Invalid query: " + strings.Repeat("x", 200) + " at position 17"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(api.QueryKeyQuery) == "forbidden" {
+			http.Error(w, "not allowed", http.StatusForbidden)
+			return
+		}
+		http.Error(w, msg, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	_, err := c.ListZettel(ctx, "title:")
+	var qErr *client.QueryError
+	if !errors.As(err, &qErr) {
+		t.Fatalf("expected QueryError, but got %v", err)
+	}
+	if qErr.Query != "title:" || qErr.Message != msg {
+		t.Errorf("unexpected query error: %q / %q", qErr.Query, qErr.Message)
+	}
+	if !strings.Contains(err.Error(), "at position 17") {
+		t.Errorf("error message truncated: %v", err)
+	}
+	var cErr *client.Error
+	if !errors.As(err, &cErr) || cErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected wrapped client error, but got %v", cErr)
+	}
+
+	if _, _, _, err = c.ListZettelJSON(ctx, "title:"); !errors.As(err, &qErr) {
+		t.Errorf("ListZettelJSON: expected QueryError, but got %v", err)
+	}
+	if _, _, err = c.ListZettelRaw(ctx, "title:"); !errors.As(err, &qErr) {
+		t.Errorf("ListZettelRaw: expected QueryError, but got %v", err)
+	}
+	if _, err = c.QueryMapMeta(ctx, "title:"); !errors.As(err, &qErr) {
+		t.Errorf("QueryMapMeta: expected QueryError, but got %v", err)
+	}
+	if _, err = c.ListZettel(ctx, "forbidden"); errors.As(err, &qErr) || !errors.As(err, &cErr) {
+		t.Errorf("expected client error only, but got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("ping must not authenticate")
+		}
+		io.WriteString(w, `(0 12 0 "" "")`)
+	}))
+	c := newTestClient(srv.URL)
+	c.SetAuth("user", "secret")
+	if err := c.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+	srv.Close()
+
+	err := c.Ping(context.Background())
+	var pErr *client.PingError
+	if !errors.As(err, &pErr) || pErr.Kind != client.PingErrorConnRefused {
+		t.Errorf("expected refused connection, but got %v", err)
+	}
+
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSrv.Close()
+	err = newTestClient(tlsSrv.URL).Ping(context.Background())
+	if !errors.As(err, &pErr) || pErr.Kind != client.PingErrorTLS {
+		t.Errorf("expected TLS failure, but got %v", err)
+	}
+}
+
+func TestNewClientChecked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/x":
+			io.WriteString(w, `(0 12 0 "" "")`)
+		case "/web/x":
+			w.Header().Set(api.HeaderContentType, api.ContentTypeHTML)
+			io.WriteString(w, "<!DOCTYPE html><html><body>Zettelstore</body></html>")
+		case "/text/x":
+			io.WriteString(w, "Hello")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	u, _ := url.Parse(srv.URL + "/api")
+	c, err := client.NewClientChecked(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := c.Base(), srv.URL+"/api/"; got != exp {
+		t.Errorf("expected base %q, but got %q", exp, got)
+	}
+
+	testcases := []struct {
+		path string
+		hint string
+	}{
+		{"/web", "got HTML, is this the WebUI URL?"},
+		{"/other", "no API found, is this the base URL of the Zettelstore?"},
+		{"/text", "response is not a version of a Zettelstore"},
+	}
+	for _, tc := range testcases {
+		u, _ = url.Parse(srv.URL + tc.path)
+		c, err = client.NewClientChecked(ctx, u)
+		var bErr *client.BaseURLError
+		if !errors.As(err, &bErr) {
+			t.Errorf("%s: expected base URL error, but got %v/%v", tc.path, c, err)
+			continue
+		}
+		if bErr.Hint != tc.hint {
+			t.Errorf("%s: expected hint %q, but got %q", tc.path, tc.hint, bErr.Hint)
+		}
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	var mx sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		calls++
+		n := calls
+		mx.Unlock()
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `(0 12 0 "" "")`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+
+	err := c.Ping(context.Background())
+	var pErr *client.PingError
+	if !errors.As(err, &pErr) || pErr.Kind != client.PingErrorHTTP {
+		t.Errorf("expected HTTP failure, but got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = c.WaitReady(ctx, 10*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected three calls, but got %d", calls)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	srv.Close()
+	if err = c.WaitReady(ctx, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, but got %v", err)
+	}
+}
+
+func TestCreateZettelFromTemplate(t *testing.T) {
+	const tmpl = `(zettel (id "00000000090001") (meta (title "New Zettel") (role "zettel") (syntax "zmk")
+  (created "20230101000000") (modified "20230102000000") (back "00000000000100") (visibility "login"))
+  (rights 4) (encoding "") (content "= {{title}}\n{{content}}\nRole: {{role}} {{author}}"))`
+	var created api.ZettelData
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, tmpl)
+			return
+		}
+		created = api.ZettelData{}
+		json.NewDecoder(r.Body).Decode(&created)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"20230704120102"}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	overrides := api.ZettelMeta{api.KeyTitle: "My {{title}}", api.KeyAuthor: "me", api.KeyVisibility: ""}
+	zid, err := c.CreateZettelFromTemplate(ctx, api.ZidTemplateNewZettel, overrides, "Text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zid != "20230704120102" {
+		t.Errorf("unexpected zettel identifier %v", zid)
+	}
+	expMeta := api.ZettelMeta{api.KeyTitle: "My {{title}}", api.KeyRole: "zettel", api.KeySyntax: "zmk", api.KeyAuthor: "me"}
+	if len(created.Meta) != len(expMeta) {
+		t.Errorf("expected metadata %v, but got %v", expMeta, created.Meta)
+	}
+	for k, v := range expMeta {
+		if got := created.Meta[k]; got != v {
+			t.Errorf("key %q: expected %q, but got %q", k, v, got)
+		}
+	}
+	if exp := "= My {{title}}\nText\nRole: zettel me"; created.Content != exp {
+		t.Errorf("expected content %q, but got %q", exp, created.Content)
+	}
+
+	created = api.ZettelData{}
+	_, err = c.CreateZettelFromTemplate(ctx, api.ZidTemplateNewZettel, nil, "Text")
+	if err == nil || !strings.Contains(err.Error(), "author") {
+		t.Errorf("expected error about missing author, but got %v", err)
+	}
+	if created.Meta != nil {
+		t.Error("no zettel must be created")
+	}
+	if _, err = c.CreateZettelFromTemplate(ctx, api.ZidTemplateNewZettel, nil, "Text", client.WithLenientPlaceholders()); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "= New Zettel\nText\nRole: zettel "; created.Content != exp {
+		t.Errorf("lenient: expected content %q, but got %q", exp, created.Content)
+	}
+}
+
+func newTestClient(base string, opts ...client.Option) *client.Client {
+	u, err := url.Parse(base)
+	if err != nil {
+		panic(err)
+	}
+	return client.NewClient(u, opts...)
+}
+
 var baseURL string
 
 func init() {
@@ -74,6 +1271,411 @@ func getClient() *client.Client {
 	return client.NewClient(u)
 }
 
+func TestCopyZettel(t *testing.T) {
+	zettel := map[string]string{
+		"/z/20230101000000": `(zettel (id "20230101000000") (meta (title "Text") (syntax "zmk") (created "20230101000000")
+  (modified "20230102000000") (published "20230102000000") (forward "00000000000100") (backward "00000000000100"))
+  (rights 4) (encoding "") (content "Some *text*"))`,
+		"/z/20230101000001": `(zettel (id "20230101000001") (meta (title "Image") (syntax "png"))
+  (rights 4) (encoding "base64") (content "iVBORw0KGgo="))`,
+	}
+	var created api.ZettelData
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, zettel[r.URL.Path])
+			return
+		}
+		created = api.ZettelData{}
+		json.NewDecoder(r.Body).Decode(&created)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":"20230704120102"}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	testcases := []struct {
+		src       api.ZettelID
+		overrides api.ZettelMeta
+		opts      []client.CopyOption
+		expMeta   api.ZettelMeta
+		expEnc    string
+		expCont   string
+	}{
+		{"20230101000000", nil, nil,
+			api.ZettelMeta{api.KeyTitle: "Text", api.KeySyntax: "zmk"}, "", "Some *text*"},
+		{"20230101000000", api.ZettelMeta{api.KeyTitle: "Copy"}, []client.CopyOption{client.WithPrecursor()},
+			api.ZettelMeta{api.KeyTitle: "Copy", api.KeySyntax: "zmk", api.KeyPrecursor: "20230101000000"}, "", "Some *text*"},
+		{"20230101000001", api.ZettelMeta{api.KeyPrecursor: ""}, []client.CopyOption{client.WithPrecursor()},
+			api.ZettelMeta{api.KeyTitle: "Image", api.KeySyntax: "png"}, "base64", "iVBORw0KGgo="},
+	}
+	for i, tc := range testcases {
+		zid, err := c.CopyZettel(ctx, tc.src, tc.overrides, tc.opts...)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if zid != "20230704120102" {
+			t.Errorf("%d: unexpected zettel identifier %v", i, zid)
+		}
+		if len(created.Meta) != len(tc.expMeta) {
+			t.Errorf("%d: expected metadata %v, but got %v", i, tc.expMeta, created.Meta)
+		}
+		for k, v := range tc.expMeta {
+			if got := created.Meta[k]; got != v {
+				t.Errorf("%d: key %q: expected %q, but got %q", i, k, v, got)
+			}
+		}
+		if created.Encoding != tc.expEnc || created.Content != tc.expCont {
+			t.Errorf("%d: expected content %q/%q, but got %q/%q", i, tc.expEnc, tc.expCont, created.Encoding, created.Content)
+		}
+	}
+}
+
+func TestGetZettelOrderData(t *testing.T) {
+	responses := map[string]string{
+		"20230101000000": `(order (id "20230101000000") (meta (title "TOC") (role "zettel")) (rights 6)
+  (list (zettel (id "20230101000001") (meta (title "One")) (rights 4))
+        (zettel (id "20230101000002") (meta (title "Two") (tags "#a #b")) (rights 2) (unknown 1))))`,
+		"20230101000003": `(order (id "20230101000003") (meta) (rights 4))`,
+		"20230101000004": `(order (id "20230101000004") (meta) (rights 4) (list (zettl (id "20230101000001"))))`,
+		"20230101000005": `(order (id "20230101000005") (meta) (rights 4) (list (zettel (meta (title "No id")))))`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc := r.URL.Query().Get(api.QueryKeyEncoding); enc != api.EncodingData {
+			t.Errorf("expected data encoding, but got %q", enc)
+		}
+		io.WriteString(w, responses[strings.TrimPrefix(r.URL.Path, "/o/")])
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	rl, err := c.GetZettelOrderData(ctx, "20230101000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.ID != "20230101000000" || rl.Rights != 6 || rl.Meta[api.KeyTitle] != "TOC" || len(rl.List) != 2 {
+		t.Fatalf("unexpected result: %v", rl)
+	}
+	if zm := rl.List[1]; zm.ID != "20230101000002" || zm.Rights != 2 || zm.Meta[api.KeyTags] != "#a #b" {
+		t.Errorf("unexpected list element: %v", zm)
+	}
+
+	rl, err = c.GetZettelOrderData(ctx, "20230101000003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rl.List) != 0 || len(rl.Meta) != 0 {
+		t.Errorf("empty list expected, but got %v", rl)
+	}
+	for _, zid := range []api.ZettelID{"20230101000004", "20230101000005"} {
+		if rl, err = c.GetZettelOrderData(ctx, zid); err == nil {
+			t.Errorf("%v: error expected, but got %v", zid, rl)
+		}
+	}
+}
+
+func TestGetUnlinkedReferences(t *testing.T) {
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		io.WriteString(w, `{"id":"20230101000000","meta":{"title":"Zettel"},"rights":6,`+
+			`"list":[{"id":"20230101000001","meta":{"title":"Other"},"rights":4}]}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	testcases := []struct {
+		opts client.UnlinkedOptions
+		exp  url.Values
+	}{
+		{client.UnlinkedOptions{}, url.Values{}},
+		{client.UnlinkedOptions{Phrase: "a b"}, url.Values{api.QueryKeyPhrase: {"a b"}}},
+		{client.UnlinkedOptions{Limit: 3}, url.Values{api.QueryKeyQuery: {"LIMIT 3"}}},
+		{client.UnlinkedOptions{Phrase: "x", Limit: 1},
+			url.Values{api.QueryKeyPhrase: {"x"}, api.QueryKeyQuery: {"LIMIT 1"}}},
+		{client.UnlinkedOptions{Limit: -1}, url.Values{}},
+	}
+	for i, tc := range testcases {
+		queries = nil
+		rl, err := c.GetUnlinkedReferences(ctx, "20230101000000", tc.opts)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if got := queries[0].Encode(); got != tc.exp.Encode() {
+			t.Errorf("%d: expected query %q, but got %q", i, tc.exp.Encode(), got)
+		}
+		if rl.Rights != 6 || len(rl.List) != 1 || rl.List[0].Rights != 4 {
+			t.Errorf("%d: unexpected result %v", i, rl)
+		}
+	}
+}
+
+func TestGetUnlinkedReferencesError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/u/20230101000000":
+			w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"id":"20230101000000","meta":{},"rights":2,"list":[{"id":"20230101000001"}]}`)
+		case "/u/20230101000001":
+			w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"bad"}`)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	rl, err := c.GetUnlinkedReferences(ctx, "20230101000000", client.UnlinkedOptions{})
+	var cerr *client.Error
+	if !errors.As(err, &cerr) || cerr.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden error, but got %v", err)
+	}
+	if rl == nil || rl.ID != "20230101000000" || rl.Rights != api.ZettelCanCreate || rl.List != nil {
+		t.Errorf("expected zettel with rights, but got %v", rl)
+	}
+
+	for _, zid := range []api.ZettelID{"20230101000001", "20230101000002"} {
+		rl, err = c.GetUnlinkedReferences(ctx, zid, client.UnlinkedOptions{})
+		if !errors.As(err, &cerr) || rl != nil {
+			t.Errorf("%s: expected error without result, but got %v/%v", zid, rl, err)
+		}
+	}
+}
+
+func TestUpdateZettelMeta(t *testing.T) {
+	zettel := map[string]string{
+		"/z/20230101000000": `(zettel (id "20230101000000") (meta (title "Text") (syntax "zmk") (tags "#a")
+  (modified "20230102000000") (back "00000000000100")) (rights 6) (encoding "") (content "Some *text*\n"))`,
+		"/z/20230101000001": `(zettel (id "20230101000001") (meta (title "Image") (syntax "png"))
+  (rights 6) (encoding "base64") (content "iVBORw0KGgo="))`,
+	}
+	var updated api.ZettelData
+	gets, puts := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+			updated = api.ZettelData{}
+			json.NewDecoder(r.Body).Decode(&updated)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		gets++
+		io.WriteString(w, zettel[r.URL.Path])
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	err := c.UpdateZettelMeta(ctx, "20230101000000", api.ZettelMeta{api.KeyTitle: "New"}, []string{api.KeyTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := api.ZettelMeta{api.KeyTitle: "New", api.KeySyntax: "zmk"}
+	if len(updated.Meta) != len(exp) || updated.Meta[api.KeyTitle] != "New" || updated.Meta[api.KeySyntax] != "zmk" {
+		t.Errorf("expected metadata %v, but got %v", exp, updated.Meta)
+	}
+	if updated.Encoding != "" || updated.Content != "Some *text*\n" {
+		t.Errorf("content changed: %q/%q", updated.Encoding, updated.Content)
+	}
+	if gets != 1 || puts != 1 {
+		t.Errorf("expected one retrieval and one update, but got %d/%d", gets, puts)
+	}
+
+	err = c.UpdateZettelMeta(ctx, "20230101000001", api.ZettelMeta{api.KeyRole: "image"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Meta[api.KeyRole] != "image" || updated.Encoding != "base64" || updated.Content != "iVBORw0KGgo=" {
+		t.Errorf("unexpected update of binary zettel: %v", updated)
+	}
+}
+
+func TestListQueries(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get(api.QueryKeyQuery)
+		queries = append(queries, q)
+		w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+		switch q {
+		case "|tags":
+			io.WriteString(w, `{"map":{"#a":["20230101000000"],"#b":["20230101000000","20230101000001"]}}`)
+		case "useless-files?":
+			io.WriteString(w, `{"query":"`+q+`","human":"","list":[{"id":"20230101000001","meta":{"useless-files":"20230101000001 a b.zettel 20230101000001.txt"},"rights":4},{"id":"20230101000002","meta":{},"rights":4}]}`)
+			return
+		case "|role":
+			io.WriteString(w, `{"map":{"zettel":["20230101000000"],"configuration":["00000000000100"]}}`)
+		default:
+			io.WriteString(w, `{"query":"`+q+`","human":"","list":[{"id":"20230101000001","meta":{"title":"B"},"rights":4},{"id":"20230101000000","meta":{"title":"A"},"rights":4}]}`)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	tags, err := c.ListTags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || len(tags["#b"]) != 2 {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	roles, err := c.ListRoles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 || roles[0] != "configuration" || roles[1] != "zettel" {
+		t.Errorf("unexpected roles: %v", roles)
+	}
+	list, err := c.RecentZettel(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != "20230101000001" {
+		t.Errorf("unexpected list: %v", list)
+	}
+	if _, err = c.RecentZettel(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	useless, err := c.ListUselessFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := useless["20230101000001"]; len(useless) != 1 || len(files) != 2 || files[0] != "20230101000001 a b.zettel" {
+		t.Errorf("unexpected useless files: %q", useless)
+	}
+	exp := []string{"|tags", "|role", "ORDER REVERSE published LIMIT 2", "ORDER REVERSE published", "useless-files?"}
+	if len(queries) != len(exp) {
+		t.Fatalf("expected queries %q, but got %q", exp, queries)
+	}
+	for i := range exp {
+		if queries[i] != exp[i] {
+			t.Errorf("%d: expected query %q, but got %q", i, exp[i], queries[i])
+		}
+	}
+}
+
+func TestListZettelModifiedSince(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get(api.QueryKeyQuery)
+		queries = append(queries, q)
+		w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+		if strings.HasPrefix(q, api.KeyModified) {
+			io.WriteString(w, `{"query":"`+q+`","human":"","list":[`+
+				`{"id":"20230101000000","meta":{"created":"20230101000000","modified":"20230301000000"},"rights":4},`+
+				`{"id":"20230102000000","meta":{"created":"20230202000000","modified":"20230203000000"},"rights":4}]}`)
+			return
+		}
+		io.WriteString(w, `{"query":"`+q+`","human":"","list":[`+
+			`{"id":"20230102000000","meta":{"created":"20230202000000","modified":"20230203000000"},"rights":4},`+
+			`{"id":"20230201000000","meta":{"created":"20230201000000"},"rights":4},`+
+			`{"id":"20230301000000","meta":{"created":"20230301000000"},"rights":4}]}`)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+
+	since := time.Date(2023, 2, 1, 0, 0, 0, 0, time.Local)
+	list, err := c.ListZettelModifiedSince(context.Background(), since.UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expQueries := []string{"modified!<20230201000000", "created!<20230201000000"}
+	if strings.Join(queries, ",") != strings.Join(expQueries, ",") {
+		t.Errorf("expected queries %q, but got %q", expQueries, queries)
+	}
+	var ids []string
+	for _, zm := range list {
+		ids = append(ids, string(zm.ID))
+	}
+	exp := "20230201000000 20230102000000 20230101000000 20230301000000"
+	if got := strings.Join(ids, " "); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+}
+
+func TestQueryMapMetaFunc(t *testing.T) {
+	const n = 20000
+	var buf bytes.Buffer
+	buf.WriteString(`{"other":[1,{"a":2}],"map":{`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `"#t%d":["20230101000000","20230102000000"]`, i)
+	}
+	buf.WriteString(`}}`)
+	payload := buf.Bytes()
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get(api.QueryKeyQuery))
+		w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+		w.Write(payload)
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	ctx := context.Background()
+
+	count := 0
+	err := c.QueryMapMetaFunc(ctx, "|tags", func(key string, zids []api.ZettelID) error {
+		if exp := "#t" + strconv.Itoa(count); key != exp || len(zids) != 2 || zids[1] != "20230102000000" {
+			t.Fatalf("expected %s with two zettel, but got %s: %v", exp, key, zids)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Errorf("expected %d values, but got %d", n, count)
+	}
+
+	var keys []string
+	err = c.QueryMapMetaFunc(ctx, "|tags", func(key string, _ []api.ZettelID) error {
+		keys = append(keys, key)
+		return nil
+	}, client.WithValuePrefix(api.KeyTags, "#t1999"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 11 || keys[0] != "#t1999" || keys[10] != "#t19999" {
+		t.Errorf("unexpected prefix result: %v", keys)
+	}
+
+	errStop := errors.New("stop")
+	count = 0
+	err = c.QueryMapMetaFunc(ctx, "|tags", func(string, []api.ZettelID) error {
+		count++
+		if count == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || count != 3 {
+		t.Errorf("expected stop after three values, but got %v after %d", err, count)
+	}
+
+	exp := []string{"|tags", "tags[#t1999 |tags", "|tags"}
+	if strings.Join(queries, ",") != strings.Join(exp, ",") {
+		t.Errorf("expected queries %q, but got %q", exp, queries)
+	}
+
+	// Decoding a value must not depend on the size of the whole map.
+	allocs := testing.AllocsPerRun(5, func() {
+		c.QueryMapMetaFunc(ctx, "|tags", func(string, []api.ZettelID) error { return errStop })
+	})
+	if allocs > 1000 {
+		t.Errorf("too many allocations for a single value: %v", allocs)
+	}
+}
+
 func TestBase(t *testing.T) {
 	exp := baseURL
 	got := getClient().Base()
@@ -0,0 +1,89 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// Header and value for gzip compressed content.
+const (
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	encodingGzip          = "gzip"
+)
+
+// minCompressSize is the minimum size of a request body to be compressed.
+const minCompressSize = 1024
+
+// WithCompression lets the client compress larger request bodies with gzip.
+// In addition, it requests gzip compressed responses and decompresses them.
+func WithCompression() Option { return func(c *Client) { c.compress = true } }
+
+// compressRequest compresses the body of the request, if it is large enough.
+func compressRequest(req *http.Request) error {
+	if req.Body == nil || req.ContentLength < minCompressSize || req.Header.Get(headerContentEncoding) != "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := io.Copy(zw, req.Body)
+	if errClose := req.Body.Close(); err == nil {
+		err = errClose
+	}
+	if errClose := zw.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+	req.ContentLength = int64(len(data))
+	req.Header.Set(headerContentEncoding, encodingGzip)
+	return nil
+}
+
+// decompressResponse lets the body of the response be decompressed, if needed.
+func decompressResponse(resp *http.Response) {
+	if resp.Header.Get(headerContentEncoding) != encodingGzip {
+		return
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del(headerContentEncoding)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// gzipBody decompresses the body of a response when it is read first. Empty
+// bodies, e.g. of a HEAD request, are therefore not an error.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (gb *gzipBody) Read(p []byte) (int, error) {
+	if gb.zr == nil && gb.err == nil {
+		gb.zr, gb.err = gzip.NewReader(gb.body)
+	}
+	if gb.err != nil {
+		return 0, gb.err
+	}
+	return gb.zr.Read(p)
+}
+
+func (gb *gzipBody) Close() error { return gb.body.Close() }
@@ -0,0 +1,77 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+
+	"zettelstore.de/c/api"
+)
+
+// CopyOption configures the copy of a zettel.
+type CopyOption func(*copyConfig)
+
+type copyConfig struct {
+	precursor bool
+}
+
+// WithPrecursor lets the copy reference the source zettel via the metadata
+// key "precursor".
+func WithPrecursor() CopyOption {
+	return func(cfg *copyConfig) { cfg.precursor = true }
+}
+
+// CopyZettel creates a new zettel with the content and the metadata of the
+// source zettel and returns the identifier of the new zettel.
+//
+// The identifier, the creation time, and all values computed by the
+// Zettelstore are not copied. The given overrides are merged into the
+// metadata; overrides with an empty value remove the key. Content and its
+// encoding are copied verbatim, so that binary zettel are copied too.
+func (c *Client) CopyZettel(
+	ctx context.Context, srcZid api.ZettelID, metaOverrides api.ZettelMeta, opts ...CopyOption,
+) (api.ZettelID, error) {
+	var cfg copyConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	src, err := c.GetZettelData(ctx, srcZid)
+	if err != nil {
+		return api.InvalidZID, err
+	}
+	if cfg.precursor {
+		if _, found := metaOverrides[api.KeyPrecursor]; !found {
+			src.Meta[api.KeyPrecursor] = string(srcZid)
+		}
+	}
+	meta := mergeMeta(src.Meta, metaOverrides)
+	return c.CreateZettelData(ctx, api.ZettelData{Meta: meta, Encoding: src.Encoding, Content: src.Content})
+}
+
+// mergeMeta returns the metadata of a zettel to be created, based on the
+// metadata of an existing zettel. Its identifier, its creation time, and all
+// computed values are removed. Overrides with an empty value remove the key.
+func mergeMeta(meta, overrides api.ZettelMeta) api.ZettelMeta {
+	result := make(api.ZettelMeta, len(meta)+len(overrides))
+	for key, val := range meta {
+		if key != api.KeyID && key != api.KeyCreated && !api.IsComputed(key) {
+			result[key] = val
+		}
+	}
+	for key, val := range overrides {
+		if val == "" {
+			delete(result, key)
+		} else {
+			result[key] = val
+		}
+	}
+	return result
+}
@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"zettelstore.de/c/api"
+)
+
+// ExportFormat specifies the archive format of an export.
+type ExportFormat uint8
+
+// Values for ExportFormat.
+const (
+	ExportZip ExportFormat = iota
+	ExportTar
+)
+
+// ExportProgressFunc is called after a zettel was written to the archive.
+type ExportProgressFunc func(done, total int)
+
+// ExportOption configures an export.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	concurrency int
+	progress    ExportProgressFunc
+}
+
+// WithExportConcurrency limits the number of zettel that are fetched concurrently.
+func WithExportConcurrency(n int) ExportOption {
+	return func(cfg *exportConfig) {
+		if n > 0 {
+			cfg.concurrency = n
+		}
+	}
+}
+
+// WithExportProgress sets a function that reports the progress of an export.
+func WithExportProgress(fn ExportProgressFunc) ExportOption {
+	return func(cfg *exportConfig) { cfg.progress = fn }
+}
+
+// ExportZettel writes all zettel selected by the query into an archive.
+//
+// Every zettel is stored in its own file, named "{zid} {title}.{syntax}". The
+// file contains the zettel in the Zettelstore text format: a metadata header,
+// an empty line, and the content. Files are ordered by zettel identifier.
+func (c *Client) ExportZettel(ctx context.Context, query string, w io.Writer, format ExportFormat, opts ...ExportOption) error {
+	cfg := exportConfig{concurrency: 4}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	var aw archiveWriter
+	switch format {
+	case ExportZip:
+		aw = &zipArchive{zw: zip.NewWriter(w)}
+	case ExportTar:
+		aw = &tarArchive{tw: tar.NewWriter(w)}
+	default:
+		return fmt.Errorf("unknown export format %d", format)
+	}
+
+	_, _, list, err := c.ListZettelJSON(ctx, query)
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := c.fetchZettelParts(ctx, list, cfg.concurrency)
+	for i, zm := range list {
+		res := <-results[i]
+		if res.err != nil {
+			return res.err
+		}
+		if err = aw.writeFile(exportFileName(zm), zettelTime(zm), res.data); err != nil {
+			return err
+		}
+		if cfg.progress != nil {
+			cfg.progress(i+1, len(list))
+		}
+	}
+	return aw.close()
+}
+
+type fetchResult struct {
+	data []byte
+	err  error
+}
+
+// fetchZettelParts retrieves the zettel of the given list concurrently. The
+// result of the i-th zettel is sent to the i-th channel.
+func (c *Client) fetchZettelParts(ctx context.Context, list []api.ZidMetaJSON, concurrency int) []chan fetchResult {
+	results := make([]chan fetchResult, len(list))
+	for i := range results {
+		results[i] = make(chan fetchResult, 1)
+	}
+	sem := make(chan struct{}, concurrency)
+	go func() {
+		for i, zm := range list {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				for j := i; j < len(list); j++ {
+					results[j] <- fetchResult{err: ctx.Err()}
+				}
+				return
+			}
+			go func(zid api.ZettelID, result chan<- fetchResult) {
+				defer func() { <-sem }()
+				data, err := c.GetZettel(ctx, zid, api.PartZettel)
+				result <- fetchResult{data: data, err: err}
+			}(zm.ID, results[i])
+		}
+	}()
+	return results
+}
+
+const maxTitleLen = 100
+
+func exportFileName(zm api.ZidMetaJSON) string {
+	ext := zm.Meta[api.KeySyntax]
+	if ext == "" || strings.IndexFunc(ext, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) >= 0 {
+		ext = "zettel"
+	}
+	title := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(zm.Meta[api.KeyTitle]))
+	if len(title) > maxTitleLen {
+		title = title[:maxTitleLen]
+		for !utf8.ValidString(title) {
+			title = title[:len(title)-1]
+		}
+		title = strings.TrimSpace(title)
+	}
+	if title == "" {
+		return string(zm.ID) + "." + ext
+	}
+	return string(zm.ID) + " " + title + "." + ext
+}
+
+// zettelTime returns the time of the last modification of a zettel, or the
+// time of its creation, as encoded by the zettel identifier.
+func zettelTime(zm api.ZidMetaJSON) time.Time {
+	for _, s := range []string{zm.Meta[api.KeyModified], zm.Meta[api.KeyCreated], string(zm.ID)} {
+		if t, ok := api.ParseTimestamp(s); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type archiveWriter interface {
+	writeFile(name string, modTime time.Time, data []byte) error
+	close() error
+}
+
+type zipArchive struct{ zw *zip.Writer }
+
+func (za *zipArchive) writeFile(name string, modTime time.Time, data []byte) error {
+	fw, err := za.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+func (za *zipArchive) close() error { return za.zw.Close() }
+
+type tarArchive struct{ tw *tar.Writer }
+
+func (ta *tarArchive) writeFile(name string, modTime time.Time, data []byte) error {
+	hdr := tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}
+	if err := ta.tw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+	_, err := ta.tw.Write(data)
+	return err
+}
+func (ta *tarArchive) close() error { return ta.tw.Close() }
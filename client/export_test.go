@@ -0,0 +1,154 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/c/client"
+)
+
+var exportZettel = map[string]string{
+	"20230102000000": "title: B/C\nsyntax: md\n\n# B",
+	"20230101000000": "title: A\nsyntax: zmk\n\nContent A",
+	"20230103000000": "syntax: png\n\nPNG",
+}
+
+func newExportServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/z" {
+			if r.URL.Query().Get(api.QueryKeyQuery) != "role:zettel" {
+				t.Errorf("wrong query: %q", r.URL.RawQuery)
+			}
+			w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+			w.Write([]byte(`{"query":"role:zettel","human":"","list":[` +
+				`{"id":"20230102000000","meta":{"title":"B/C","syntax":"md"},"rights":2},` +
+				`{"id":"20230103000000","meta":{"syntax":"png"},"rights":2},` +
+				`{"id":"20230101000000","meta":{"title":"A","syntax":"zmk","modified":"20230201000000"},"rights":2}]}`))
+			return
+		}
+		zid := strings.TrimPrefix(r.URL.Path, "/z/")
+		if r.URL.Query().Get(api.QueryKeyPart) != api.PartZettel {
+			t.Errorf("wrong part: %q", r.URL.RawQuery)
+		}
+		if content, found := exportZettel[zid]; found {
+			w.Write([]byte(content))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+var exportNames = []string{
+	"20230101000000 A.zmk",
+	"20230102000000 B_C.md",
+	"20230103000000.png",
+}
+
+func TestExportZip(t *testing.T) {
+	srv := newExportServer(t)
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	var buf bytes.Buffer
+	var progress []int
+	err := c.ExportZettel(context.Background(), "role:zettel", &buf, client.ExportZip,
+		client.WithExportConcurrency(2),
+		client.WithExportProgress(func(done, total int) {
+			if total != len(exportNames) {
+				t.Errorf("wrong total: %d", total)
+			}
+			progress = append(progress, done)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != len(exportNames) || progress[len(progress)-1] != len(exportNames) {
+		t.Errorf("wrong progress: %v", progress)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != len(exportNames) {
+		t.Fatalf("expected %d files, but got %d", len(exportNames), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != exportNames[i] {
+			t.Errorf("%d: expected name %q, but got %q", i, exportNames[i], f.Name)
+		}
+		rc, err2 := f.Open()
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if exp := exportZettel[exportNames[i][:14]]; string(data) != exp {
+			t.Errorf("%d: expected content %q, but got %q", i, exp, data)
+		}
+	}
+	if got := zr.File[0].Modified.Format("20060102"); got != "20230201" {
+		t.Errorf("expected modification date 20230201, but got %s", got)
+	}
+}
+
+func TestExportTar(t *testing.T) {
+	srv := newExportServer(t)
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	var buf1, buf2 bytes.Buffer
+	if err := c.ExportZettel(context.Background(), "role:zettel", &buf1, client.ExportTar); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExportZettel(context.Background(), "role:zettel", &buf2, client.ExportTar); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("export is not deterministic")
+	}
+	tr := tar.NewReader(&buf1)
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if i != len(exportNames) {
+				t.Errorf("expected %d files, but got %d", len(exportNames), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != exportNames[i] {
+			t.Errorf("%d: expected name %q, but got %q", i, exportNames[i], hdr.Name)
+		}
+	}
+}
+
+func TestExportError(t *testing.T) {
+	srv := newExportServer(t)
+	defer srv.Close()
+	delete(exportZettel, "20230103000000")
+	defer func() { exportZettel["20230103000000"] = "syntax: png\n\nPNG" }()
+	c := newTestClient(srv.URL)
+	var buf bytes.Buffer
+	err := c.ExportZettel(context.Background(), "role:zettel", &buf, client.ExportZip)
+	if cErr, ok := err.(*client.Error); !ok || cErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, but got %v", err)
+	}
+}
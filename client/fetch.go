@@ -0,0 +1,142 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"zettelstore.de/c/api"
+)
+
+// FetchRequest specifies what Fetch should retrieve.
+type FetchRequest struct {
+	// Zid of the zettel to retrieve. If it is empty, a list of zettel is
+	// retrieved, selected by Query.
+	Zid api.ZettelID
+
+	// Query selects the zettel of a list. It must be empty, if Zid is given.
+	Query string
+
+	// Part of the zettel to retrieve. An empty value uses the default of the
+	// Zettelstore.
+	Part string
+
+	// Encoding of the response. EncoderUnknown retrieves the zettel (or the
+	// list) without a specific encoding, i.e. in its plain form.
+	Encoding api.EncodingEnum
+
+	// ParseOnly retrieves the parsed zettel, not the evaluated one.
+	ParseOnly bool
+
+	// Extra query parameter, which are appended to the request URL.
+	Extra url.Values
+}
+
+// FetchResponse is the successful result of Fetch. The caller must close
+// Body.
+type FetchResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        io.ReadCloser
+}
+
+// Fetch retrieves a zettel or a list of zettel, as specified by the request.
+// It is the generic form of the more specific methods, like GetZettel,
+// GetMeta, or ListZettel.
+//
+// Only a successful response is returned, i.e. with status code "200 OK" or
+// "204 No Content". All other status codes result in an error.
+func (c *Client) Fetch(ctx context.Context, fr FetchRequest) (*FetchResponse, error) {
+	ub, err := c.fetchURLBuilder(fr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.buildAndExecuteRequest(ctx, http.MethodGet, ub, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+	default:
+		defer resp.Body.Close()
+		if fr.Zid == "" {
+			return nil, queryStatusToError(resp, fr.Query)
+		}
+		return nil, statusToError(resp)
+	}
+	return &FetchResponse{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get(api.HeaderContentType),
+		Body:        resp.Body,
+	}, nil
+}
+
+func (c *Client) fetchURLBuilder(fr FetchRequest) (*api.URLBuilder, error) {
+	if fr.Zid != "" && fr.Query != "" {
+		return nil, errors.New("fetch needs either a zettel identifier or a query, not both")
+	}
+	if fr.Part != "" && !api.IsValidPart(fr.Part) {
+		return nil, fmt.Errorf("invalid part %q", fr.Part)
+	}
+	if fr.Encoding != api.EncoderUnknown && api.Encoder(fr.Encoding.String()) == api.EncoderUnknown {
+		return nil, fmt.Errorf("unknown encoding %v", fr.Encoding)
+	}
+
+	ub := c.newURLBuilder('z')
+	if fr.Zid != "" {
+		ub.SetZid(fr.Zid)
+	}
+	if fr.Encoding != api.EncoderUnknown {
+		ub.WithEncoding(fr.Encoding)
+	}
+	if fr.Part != "" {
+		ub.WithPart(fr.Part)
+	}
+	if fr.ParseOnly {
+		ub.WithParseOnly()
+	}
+	if fr.Zid == "" {
+		ub.AppendQuery(fr.Query)
+	}
+
+	keys := make([]string, 0, len(fr.Extra))
+	for key := range fr.Extra {
+		switch key {
+		case api.QueryKeyEncoding, api.QueryKeyPart, api.QueryKeyParseOnly, api.QueryKeyQuery:
+			return nil, fmt.Errorf("query parameter %q must not be given as extra", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, val := range fr.Extra[key] {
+			ub.AppendKVQuery(key, val)
+		}
+	}
+	return ub, nil
+}
+
+// checkEncoding returns an error, if the content type of the response does
+// not match the given encoding. A missing content type is accepted.
+func (fr *FetchResponse) checkEncoding(enc api.EncodingEnum) error {
+	ct := fr.ContentType
+	if ct == "" || api.EncodingFromContentType(ct) == api.EncodingFromContentType(enc.ContentType()) {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(fr.Body, maxContentTypeBody))
+	return &ErrUnexpectedContentType{ContentType: ct, Encoding: enc, Body: body}
+}
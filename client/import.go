@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"zettelstore.de/c/api"
+)
+
+// ImportOptions controls how zettel are imported.
+type ImportOptions struct {
+	// Overwrite existing zettel, instead of skipping them.
+	Overwrite bool
+
+	// DryRun parses all files and checks for conflicts, but does not change
+	// the Zettelstore.
+	DryRun bool
+
+	// OnConflict is called for every file that contains a zettel whose
+	// identifier is already used by the Zettelstore.
+	OnConflict func(filename string, zid api.ZettelID)
+}
+
+// ImportZettel reads all files with the extension ".zettel" or ".zmk" from the
+// given file system and stores them in the Zettelstore. Every file must start
+// with a metadata header, i.e. lines of the form "key: value" up to the first
+// empty line.
+//
+// If the file name starts with a zettel identifier, or if the metadata contains
+// an identifier, and a zettel with this identifier already exists, it is
+// updated or skipped, depending on the options. All other files result in new
+// zettel, whose identifier are returned.
+func (c *Client) ImportZettel(ctx context.Context, fsys fs.FS, opts ImportOptions) (created []api.ZettelID, err error) {
+	err = fs.WalkDir(fsys, ".", func(filename string, d fs.DirEntry, errWalk error) error {
+		if errWalk != nil {
+			return errWalk
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := path.Ext(filename); ext != ".zettel" && ext != ".zmk" {
+			return nil
+		}
+		data, errRead := fs.ReadFile(fsys, filename)
+		if errRead != nil {
+			return errRead
+		}
+		zid, errParse := importZid(filename, data)
+		if errParse != nil {
+			return errParse
+		}
+		if zid != api.InvalidZID {
+			exists, errExists := c.zettelExists(ctx, zid)
+			if errExists != nil {
+				return errExists
+			}
+			if exists {
+				if opts.OnConflict != nil {
+					opts.OnConflict(filename, zid)
+				}
+				if !opts.Overwrite || opts.DryRun {
+					return nil
+				}
+				return c.UpdateZettel(ctx, zid, data)
+			}
+		}
+		if opts.DryRun {
+			return nil
+		}
+		newZid, errCreate := c.CreateZettel(ctx, data)
+		if errCreate != nil {
+			return errCreate
+		}
+		created = append(created, newZid)
+		return nil
+	})
+	return created, err
+}
+
+// importZid returns the zettel identifier of a file to be imported.
+func importZid(filename string, data []byte) (api.ZettelID, error) {
+	meta, _, err := api.ParseZettel(data)
+	if err != nil {
+		return api.InvalidZID, fmt.Errorf("%s: %w", filename, err)
+	}
+	if base := path.Base(filename); len(base) >= api.LengthZid {
+		if zid := api.ZettelID(base[:api.LengthZid]); zid.IsValid() {
+			return zid, nil
+		}
+	}
+	if zid := api.ZettelID(meta[api.KeyID]); zid.IsValid() {
+		return zid, nil
+	}
+	return api.InvalidZID, nil
+}
+
+func (c *Client) zettelExists(ctx context.Context, zid api.ZettelID) (bool, error) {
+	_, err := c.GetMeta(ctx, zid)
+	if err == nil {
+		return true, nil
+	}
+	var cErr *Error
+	if errors.As(err, &cErr) && cErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,124 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/c/client"
+)
+
+var importFS = fstest.MapFS{
+	"a/20230101000000 Existing.zettel": {Data: []byte("title: Existing\n\nold content")},
+	"a/new.zmk":                        {Data: []byte("title: New\ntags: #a\n  #b\n\nnew content")},
+	"b/20230102000000.zettel":          {Data: []byte("title: Missing\n\n")},
+	"b/meta-id.zettel":                 {Data: []byte("id: 20230101000000\ntitle: Meta\n\n")},
+	"c/readme.txt":                     {Data: []byte("not a zettel")},
+}
+
+type importServer struct {
+	*httptest.Server
+	requests []string
+	nextZid  int
+}
+
+func newImportServer() *importServer {
+	is := &importServer{nextZid: 20230301000000}
+	is.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Path == "/z/20230101000000" {
+				w.Header().Set(api.HeaderContentType, api.ContentTypeJSON)
+				w.Write([]byte(`{"meta":{"title":"Existing"},"rights":6}`))
+				return
+			}
+			http.NotFound(w, r)
+			return
+		case http.MethodPost:
+			is.requests = append(is.requests, "POST "+strings.SplitN(string(body), "\n", 2)[0])
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, is.nextZid)
+			is.nextZid++
+		case http.MethodPut:
+			is.requests = append(is.requests, "PUT "+r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return is
+}
+
+func TestImportZettel(t *testing.T) {
+	testcases := []struct {
+		name      string
+		opts      client.ImportOptions
+		created   int
+		requests  string
+		conflicts string
+	}{
+		{"skip", client.ImportOptions{}, 2,
+			"POST title: New,POST title: Missing",
+			"a/20230101000000 Existing.zettel,b/meta-id.zettel"},
+		{"overwrite", client.ImportOptions{Overwrite: true}, 2,
+			"PUT /z/20230101000000,POST title: New,POST title: Missing,PUT /z/20230101000000",
+			"a/20230101000000 Existing.zettel,b/meta-id.zettel"},
+		{"dry-run", client.ImportOptions{Overwrite: true, DryRun: true}, 0,
+			"",
+			"a/20230101000000 Existing.zettel,b/meta-id.zettel"},
+	}
+	for _, tc := range testcases {
+		srv := newImportServer()
+		c := newTestClient(srv.URL)
+		var conflicts []string
+		tc.opts.OnConflict = func(filename string, zid api.ZettelID) {
+			if zid != "20230101000000" {
+				t.Errorf("%s: wrong conflicting zid %q", tc.name, zid)
+			}
+			conflicts = append(conflicts, filename)
+		}
+		created, err := c.ImportZettel(context.Background(), importFS, tc.opts)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(created) != tc.created {
+			t.Errorf("%s: expected %d created zettel, but got %v", tc.name, tc.created, created)
+		}
+		if got := strings.Join(srv.requests, ","); got != tc.requests {
+			t.Errorf("%s: expected requests %q, but got %q", tc.name, tc.requests, got)
+		}
+		if got := strings.Join(conflicts, ","); got != tc.conflicts {
+			t.Errorf("%s: expected conflicts %q, but got %q", tc.name, tc.conflicts, got)
+		}
+	}
+}
+
+func TestImportZettelInvalidHeader(t *testing.T) {
+	srv := newImportServer()
+	defer srv.Close()
+	c := newTestClient(srv.URL)
+	fsys := fstest.MapFS{"bad.zettel": {Data: []byte("no metadata\n\ncontent")}}
+	if _, err := c.ImportZettel(context.Background(), fsys, client.ImportOptions{}); err == nil {
+		t.Error("error expected")
+	}
+	if len(srv.requests) != 0 {
+		t.Errorf("no requests expected, but got %v", srv.requests)
+	}
+}
@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/c/maps"
+)
+
+// ListTags returns a map of all tags to the zettel that contain them.
+func (c *Client) ListTags(ctx context.Context) (api.MapMeta, error) {
+	return c.aggregateMeta(ctx, api.KeyTags)
+}
+
+// ListRoles returns the sorted list of all zettel roles.
+func (c *Client) ListRoles(ctx context.Context) ([]string, error) {
+	mm, err := c.aggregateMeta(ctx, api.KeyRole)
+	if err != nil {
+		return nil, err
+	}
+	return maps.Keys(mm), nil
+}
+
+// aggregateMeta returns a map of all values of the given metadata key to the
+// zettel that contain them.
+func (c *Client) aggregateMeta(ctx context.Context, key string) (api.MapMeta, error) {
+	return c.QueryMapMeta(ctx, api.ActionSeparator+key)
+}
+
+// RecentZettel returns the n most recently changed zettel, i.e. ordered by
+// their last modification or, if never modified, by their creation.
+func (c *Client) RecentZettel(ctx context.Context, n int) ([]api.ZidMetaJSON, error) {
+	_, _, list, err := c.ListZettelJSON(ctx, recentQuery(n))
+	return list, err
+}
+
+func recentQuery(n int) string {
+	q := api.OrderDirective + " " + api.ReverseDirective + " " + api.KeyPublished
+	if n > 0 {
+		q += " " + api.LimitDirective + " " + strconv.Itoa(n)
+	}
+	return q
+}
+
+// ListZettelModifiedSince returns all zettel that were modified or, if never
+// modified, created at or after the given time. The list is sorted by the time
+// of the last change, oldest first.
+//
+// The Zettelstore stores timestamps in its local time zone without any zone
+// information. Therefore, the given time is converted into the local time zone
+// of the client, time.Local, which must match the time zone of the
+// Zettelstore.
+func (c *Client) ListZettelModifiedSince(ctx context.Context, t time.Time) ([]api.ZidMetaJSON, error) {
+	ts := api.FormatTimestamp(t.In(time.Local))
+	_, _, modified, err := c.ListZettelJSON(ctx, api.KeyModified+api.SearchOperatorNotLess+ts)
+	if err != nil {
+		return nil, err
+	}
+	_, _, created, err := c.ListZettelJSON(ctx, api.KeyCreated+api.SearchOperatorNotLess+ts)
+	if err != nil {
+		return nil, err
+	}
+	return mergeZettelLists(modified, created), nil
+}
+
+// mergeZettelLists returns the union of both lists, without duplicates, and
+// sorted by the time of the last change.
+func mergeZettelLists(lists ...[]api.ZidMetaJSON) []api.ZidMetaJSON {
+	seen := map[api.ZettelID]bool{}
+	var result []api.ZidMetaJSON
+	for _, list := range lists {
+		for _, zm := range list {
+			if !seen[zm.ID] {
+				seen[zm.ID] = true
+				result = append(result, zm)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		ti, tj := zettelTime(result[i]), zettelTime(result[j])
+		if ti.Equal(tj) {
+			return result[i].ID < result[j].ID
+		}
+		return ti.Before(tj)
+	})
+	return result
+}
+
+// ListUselessFiles returns all zettel, whose directory box contains files that
+// are not used for the zettel, together with the names of these files.
+func (c *Client) ListUselessFiles(ctx context.Context) (map[api.ZettelID][]string, error) {
+	_, _, list, err := c.ListZettelJSON(ctx, api.KeyUselessFiles+api.ExistOperator)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[api.ZettelID][]string, len(list))
+	for _, zm := range list {
+		if files := api.ParseUselessFiles(zm.Meta[api.KeyUselessFiles]); len(files) > 0 {
+			result[zm.ID] = files
+		}
+	}
+	return result, nil
+}
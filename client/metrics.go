@@ -0,0 +1,90 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallStats contains statistics about requests with the same HTTP method to
+// the same endpoint.
+type CallStats struct {
+	Count         int           // Number of requests
+	Errors        int           // Number of failed requests, including HTTP status >= 400
+	Canceled      int           // Number of failed requests, whose context was canceled
+	Timeouts      int           // Number of failed requests, whose deadline expired
+	TotalDuration time.Duration // Sum of all request durations
+	MaxDuration   time.Duration // Duration of the slowest request
+}
+
+type metrics struct {
+	mx    sync.Mutex
+	stats map[string]CallStats
+}
+
+func (m *metrics) record(key string, d time.Duration, failed bool, err error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.stats == nil {
+		m.stats = make(map[string]CallStats)
+	}
+	cs := m.stats[key]
+	cs.Count++
+	if failed {
+		cs.Errors++
+	}
+	if IsCanceled(err) {
+		cs.Canceled++
+	} else if IsTimeout(err) {
+		cs.Timeouts++
+	}
+	cs.TotalDuration += d
+	if d > cs.MaxDuration {
+		cs.MaxDuration = d
+	}
+	m.stats[key] = cs
+}
+
+// MetricsSnapshot returns the statistics of all requests executed so far. The
+// map key consists of the HTTP method and the endpoint key of the API, e.g.
+// "GET z" for retrieving zettel.
+func (c *Client) MetricsSnapshot() map[string]CallStats {
+	c.metrics.mx.Lock()
+	defer c.metrics.mx.Unlock()
+	result := make(map[string]CallStats, len(c.metrics.stats))
+	for k, v := range c.metrics.stats {
+		result[k] = v
+	}
+	return result
+}
+
+// ResetMetrics removes all statistics collected so far.
+func (c *Client) ResetMetrics() {
+	c.metrics.mx.Lock()
+	c.metrics.stats = nil
+	c.metrics.mx.Unlock()
+}
+
+func (c *Client) recordMetrics(req *http.Request, resp *http.Response, err error, d time.Duration) {
+	c.metrics.record(req.Method+" "+c.endpointKey(req), d, err != nil || resp.StatusCode >= 400, err)
+}
+
+// endpointKey returns the key of the API endpoint that is addressed by the request.
+func (c *Client) endpointKey(req *http.Request) string {
+	local := strings.TrimPrefix(req.URL.String(), c.base)
+	if pos := strings.IndexAny(local, "/?"); pos >= 0 {
+		local = local[:pos]
+	}
+	return local
+}
@@ -0,0 +1,212 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/sx.fossil/sxpf/reader"
+)
+
+// PingErrorKind classifies the reason why a Zettelstore is not reachable.
+type PingErrorKind uint8
+
+// Values for PingErrorKind.
+const (
+	PingErrorOther       PingErrorKind = iota // Other errors
+	PingErrorConnRefused                      // Connection was refused
+	PingErrorTLS                              // TLS handshake or certificate failed
+	PingErrorTimeout                          // Request timed out
+	PingErrorHTTP                             // Zettelstore answered with an error status
+)
+
+// String returns a textual representation of the error kind.
+func (kind PingErrorKind) String() string {
+	switch kind {
+	case PingErrorConnRefused:
+		return "connection refused"
+	case PingErrorTLS:
+		return "TLS failure"
+	case PingErrorTimeout:
+		return "timeout"
+	case PingErrorHTTP:
+		return "HTTP failure"
+	}
+	return "failure"
+}
+
+// PingError is returned by Ping, if the Zettelstore is not reachable.
+type PingError struct {
+	Kind PingErrorKind
+	Err  error
+}
+
+func (err *PingError) Error() string { return "ping: " + err.Kind.String() + ": " + err.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (err *PingError) Unwrap() error { return err.Err }
+
+// Ping checks whether the Zettelstore is reachable. It sends a cheap request
+// that needs no authentication, i.e. it does not retrieve or refresh an
+// authentication token. If the Zettelstore is not reachable, an error of type
+// *PingError is returned.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodGet, c.newURLBuilder('x'), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return &PingError{Kind: classifyPingError(err), Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &PingError{Kind: PingErrorHTTP, Err: statusToError(resp)}
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func classifyPingError(err error) PingErrorKind {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PingErrorConnRefused
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return PingErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return PingErrorTimeout
+	}
+	var (
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostErr      x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return PingErrorTLS
+	}
+	return PingErrorOther
+}
+
+// WaitReady calls Ping repeatedly with the given interval, until the
+// Zettelstore is reachable or the context is done.
+func (c *Client) WaitReady(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// BaseURLError is returned by NewClientChecked, if the given URL does not
+// refer to the API of a Zettelstore.
+type BaseURLError struct {
+	URL  string // Base URL of the client
+	Hint string // Probable cause of the error
+	Err  error
+}
+
+func (err *BaseURLError) Error() string {
+	return "check " + err.URL + ": " + err.Hint + ": " + err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *BaseURLError) Unwrap() error { return err.Err }
+
+// maxVersionBody limits the size of the response read by NewClientChecked.
+const maxVersionBody = 4096
+
+// NewClientChecked creates a new client, like NewClient, and checks whether
+// the URL refers to the API of a Zettelstore, by retrieving its version. No
+// authentication is needed for this. If the check fails, an error of type
+// *BaseURLError is returned, which contains a hint about the probable cause,
+// e.g. that the URL of the WebUI was given.
+func NewClientChecked(ctx context.Context, u *url.URL, opts ...Option) (*Client, error) {
+	c := NewClient(u, opts...)
+	if hint, err := c.checkBase(ctx); err != nil {
+		return nil, &BaseURLError{URL: c.base, Hint: hint, Err: err}
+	}
+	return c, nil
+}
+
+func (c *Client) checkBase(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.newURLBuilder('x'), nil)
+	if err != nil {
+		return "invalid URL", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		switch classifyPingError(err) {
+		case PingErrorConnRefused:
+			return "no server found, is the port correct?", err
+		case PingErrorTLS:
+			return "TLS failed, does the server use HTTPS?", err
+		case PingErrorTimeout:
+			return "server did not answer in time", err
+		}
+		return "server not reachable", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxVersionBody))
+	if err != nil {
+		return "response not readable", err
+	}
+	if isHTML(resp.Header.Get(api.HeaderContentType), body) {
+		return "got HTML, is this the WebUI URL?", fmt.Errorf("status %d, content type %q", resp.StatusCode, resp.Header.Get(api.HeaderContentType))
+	}
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &Error{StatusCode: resp.StatusCode, Message: resp.Status[4:], Body: body}
+		if resp.StatusCode == http.StatusNotFound {
+			return "no API found, is this the base URL of the Zettelstore?", statusErr
+		}
+		return "Zettelstore answered with an error", statusErr
+	}
+	obj, err := reader.MakeReader(bytes.NewReader(body)).Read()
+	if err == nil {
+		_, err = parseVersionInfo(obj)
+	}
+	if err != nil {
+		return "response is not a version of a Zettelstore", err
+	}
+	return "", nil
+}
+
+func isHTML(ct string, body []byte) bool {
+	if api.EncodingFromContentType(ct) == api.EncoderHTML {
+		return true
+	}
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && body[0] == '<'
+}
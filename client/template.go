@@ -0,0 +1,87 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"zettelstore.de/c/api"
+)
+
+// TemplateOption configures the creation of a zettel from a template.
+type TemplateOption func(*templateConfig)
+
+type templateConfig struct {
+	lenient bool
+}
+
+// WithLenientPlaceholders replaces placeholders without a value by an empty
+// string, instead of returning an error.
+func WithLenientPlaceholders() TemplateOption {
+	return func(cfg *templateConfig) { cfg.lenient = true }
+}
+
+// placeholderRe matches the placeholders of a template, e.g. "{{title}}".
+var placeholderRe = regexp.MustCompile(`\{\{([a-z0-9-]+)\}\}`)
+
+// CreateZettelFromTemplate creates a new zettel, based on a template zettel.
+//
+// The metadata of the template zettel, without its identifier, its creation
+// time, and all values computed by the Zettelstore, is merged with the given
+// overrides. Overrides with an empty value remove the key.
+//
+// The content of the template may contain placeholders of the form
+// "{{key}}", where key is a valid metadata key. The placeholder "{{content}}"
+// is replaced by the given content, all other placeholders are replaced by the
+// value of the key in the merged metadata. If there is no such value, an error
+// is returned, unless WithLenientPlaceholders is given. Placeholders are
+// replaced only once, i.e. placeholders within the substituted values are not
+// replaced.
+func (c *Client) CreateZettelFromTemplate(
+	ctx context.Context, templateZid api.ZettelID, overrides api.ZettelMeta, content string, opts ...TemplateOption,
+) (api.ZettelID, error) {
+	var cfg templateConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	tmpl, err := c.GetZettelData(ctx, templateZid)
+	if err != nil {
+		return api.InvalidZID, err
+	}
+	meta := mergeMeta(tmpl.Meta, overrides)
+	text, err := fillTemplate(tmpl.Content, meta, content, cfg.lenient)
+	if err != nil {
+		return api.InvalidZID, fmt.Errorf("template %v: %w", templateZid, err)
+	}
+	return c.CreateZettelData(ctx, api.ZettelData{Meta: meta, Encoding: tmpl.Encoding, Content: text})
+}
+
+func fillTemplate(tmpl string, meta api.ZettelMeta, content string, lenient bool) (string, error) {
+	var missing []string
+	result := placeholderRe.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		key := ph[2 : len(ph)-2]
+		if key == "content" {
+			return content
+		}
+		if val, found := meta[key]; found {
+			return val
+		}
+		missing = append(missing, key)
+		return ""
+	})
+	if len(missing) > 0 && !lenient {
+		return "", fmt.Errorf("no value for placeholder(s) %s", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package client
+
+import (
+	"context"
+
+	"zettelstore.de/c/api"
+)
+
+// UpdateZettelMeta changes only the metadata of a zettel. Values of the patch
+// are set, keys of removeKeys are removed. The content of the zettel and its
+// encoding are written back verbatim, so that binary zettel are not changed.
+//
+// Since the Zettelstore does not allow to update metadata separately, the
+// whole zettel is retrieved, modified, and stored. The Zettelstore does not
+// support conditional updates. Therefore, if the zettel is changed by someone
+// else between retrieving and storing it, that change is lost.
+func (c *Client) UpdateZettelMeta(ctx context.Context, zid api.ZettelID, patch api.ZettelMeta, removeKeys []string) error {
+	data, err := c.GetZettelData(ctx, zid)
+	if err != nil {
+		return err
+	}
+	meta := patchMeta(data.Meta, patch, removeKeys)
+	return c.UpdateZettelData(ctx, zid, api.ZettelData{Meta: meta, Encoding: data.Encoding, Content: data.Content})
+}
+
+// patchMeta returns the metadata to be stored for an updated zettel. All
+// values computed by the Zettelstore are removed.
+func patchMeta(meta, patch api.ZettelMeta, removeKeys []string) api.ZettelMeta {
+	result := make(api.ZettelMeta, len(meta)+len(patch))
+	for key, val := range meta {
+		if key != api.KeyID && !api.IsComputed(key) {
+			result[key] = val
+		}
+	}
+	for key, val := range patch {
+		result[key] = val
+	}
+	for _, key := range removeKeys {
+		delete(result, key)
+	}
+	return result
+}
@@ -12,6 +12,7 @@ package maps
 
 import "sort"
 
+// Keys returns the sorted list of all keys of the map.
 func Keys[T any](m map[string]T) []string {
 	if len(m) == 0 {
 		return nil
@@ -23,3 +24,34 @@ func Keys[T any](m map[string]T) []string {
 	sort.Strings(result)
 	return result
 }
+
+// SortedValues returns the values of the map, ordered by their keys.
+func SortedValues[T any](m map[string]T) []T {
+	keys := Keys(m)
+	if keys == nil {
+		return nil
+	}
+	result := make([]T, len(keys))
+	for i, k := range keys {
+		result[i] = m[k]
+	}
+	return result
+}
+
+// MinMaxKey returns the smallest and the largest key of the map. The last
+// result is false, if the map is empty.
+func MinMaxKey[T any](m map[string]T) (minKey, maxKey string, ok bool) {
+	for k := range m {
+		if !ok {
+			minKey, maxKey, ok = k, k, true
+			continue
+		}
+		if k < minKey {
+			minKey = k
+		}
+		if k > maxKey {
+			maxKey = k
+		}
+	}
+	return minKey, maxKey, ok
+}
@@ -44,3 +44,54 @@ func TestKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestKeysValueTypes(t *testing.T) {
+	if got := maps.Keys(map[string]int{"b": 2, "a": 1}); len(got) != 2 || got[0] != "a" {
+		t.Errorf("int values: %v", got)
+	}
+	if got := maps.Keys(map[string][]string{"y": nil, "x": {"1"}}); len(got) != 2 || got[0] != "x" {
+		t.Errorf("slice values: %v", got)
+	}
+	type value struct{ n int }
+	if got := maps.Keys(map[string]*value{"q": nil}); len(got) != 1 || got[0] != "q" {
+		t.Errorf("pointer values: %v", got)
+	}
+}
+
+func TestSortedValues(t *testing.T) {
+	if got := maps.SortedValues(map[string]int(nil)); got != nil {
+		t.Errorf("nil map: expected nil, but got %v", got)
+	}
+	got := maps.SortedValues(map[string]int{"c": 3, "a": 1, "b": 2})
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("int values: expected [1 2 3], but got %v", got)
+	}
+	gotS := maps.SortedValues(map[string]string{"z": "last", "a": "first"})
+	if len(gotS) != 2 || gotS[0] != "first" || gotS[1] != "last" {
+		t.Errorf("string values: expected [first last], but got %v", gotS)
+	}
+}
+
+func TestMinMaxKey(t *testing.T) {
+	if _, _, ok := maps.MinMaxKey(map[string]bool{}); ok {
+		t.Error("empty map must not have keys")
+	}
+	testcases := []struct {
+		keys     []string
+		min, max string
+	}{
+		{[]string{"a"}, "a", "a"},
+		{[]string{"m", "b", "x", ""}, "", "x"},
+		{[]string{"20230102", "20230101", "20230103"}, "20230101", "20230103"},
+	}
+	for i, tc := range testcases {
+		m := make(map[string]float64, len(tc.keys))
+		for _, k := range tc.keys {
+			m[k] = 0
+		}
+		minKey, maxKey, ok := maps.MinMaxKey(m)
+		if !ok || minKey != tc.min || maxKey != tc.max {
+			t.Errorf("%d: expected %q/%q, but got %q/%q/%v", i, tc.min, tc.max, minKey, maxKey, ok)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package shtml
+
+import (
+	"strings"
+
+	"zettelstore.de/c/sz"
+	"zettelstore.de/sx.fossil/sxpf"
+	"zettelstore.de/sx.fossil/sxpf/eval"
+)
+
+// quoteStyle stores the quotation marks of a language.
+type quoteStyle struct {
+	primary, secondary [2]string
+}
+
+// SetQuoteStyle sets the opening and closing quotation marks for quotes of the
+// given language. The primary marks are used for a quote, the secondary marks
+// for a quote within a quote, and so on alternately. The language of a quote
+// is its own "lang" attribute, or the one of the enclosing quote, span, or
+// region. The style of the empty language is used, if there is no style for
+// the language of a quote.
+//
+// If at least one style is set, quotes are written as a HTML element "span"
+// that contains these marks as text, instead of using the HTML element "q".
+func (tr *Transformer) SetQuoteStyle(lang string, primary, secondary [2]string) {
+	if tr.quoteStyles == nil {
+		tr.quoteStyles = make(map[string]quoteStyle)
+	}
+	tr.quoteStyles[lang] = quoteStyle{primary: primary, secondary: secondary}
+}
+
+// findQuoteStyle returns the quote style of the given language, e.g. "de-CH",
+// its base language, e.g. "de", or of the empty language.
+func (tr *Transformer) findQuoteStyle(lang string) (quoteStyle, bool) {
+	if style, found := tr.quoteStyles[lang]; found {
+		return style, true
+	}
+	if base, _, hasRegion := strings.Cut(lang, "-"); hasRegion {
+		if style, found := tr.quoteStyles[base]; found {
+			return style, true
+		}
+	}
+	style, found := tr.quoteStyles[""]
+	return style, found
+}
+
+// marks returns the quotation marks of a quote that is nested within the given
+// number of quotes.
+func (qs quoteStyle) marks(depth int) [2]string {
+	if depth%2 == 1 {
+		return qs.secondary
+	}
+	return qs.primary
+}
+
+// evaluate evaluates an AST object, like the engine does. If quotes are written
+// with quotation marks, it additionally tracks the nesting depth of quotes and
+// the language of the enclosing elements, while the arguments of a quote, a
+// span, or a region are evaluated. Both are needed to select the quotation
+// marks when the quote itself is transformed.
+func (te *TransformEnv) evaluate(obj sxpf.Object) (sxpf.Object, error) {
+	if len(te.tr.quoteStyles) == 0 {
+		return te.engine.Eval(te.astEnv, obj)
+	}
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair || pair == nil {
+		return te.engine.Eval(te.astEnv, obj)
+	}
+	sym, isSymbol := sxpf.GetSymbol(pair.Car())
+	if !isSymbol {
+		return te.engine.Eval(te.astEnv, obj)
+	}
+	fnObj, found := te.astEnv.Lookup(sym)
+	if !found {
+		return te.engine.Eval(te.astEnv, obj)
+	}
+	fn, isCallable := eval.GetCallable(fnObj)
+	if !isCallable {
+		// E.g. the syntax "quote", which must not evaluate its argument.
+		return te.engine.Eval(te.astEnv, obj)
+	}
+
+	depth, lang := te.quoteDepth, te.lang
+	var args []sxpf.Object
+	for node := pair.Tail(); node != nil; node = node.Tail() {
+		val, err := te.evaluate(node.Car())
+		if err != nil {
+			te.quoteDepth, te.lang = depth, lang
+			return nil, err
+		}
+		if args == nil {
+			te.enterForm(sym.Name(), val)
+		}
+		args = append(args, val)
+	}
+	te.quoteDepth, te.lang = depth, lang
+	return fn.Call(te.engine, te.astEnv, args)
+}
+
+// enterForm updates the quote state for evaluating the remaining arguments of
+// the given form. The attributes of quotes, spans, and regions are their first
+// argument.
+func (te *TransformEnv) enterForm(name string, attrVal sxpf.Object) {
+	switch name {
+	case sz.NameSymFormatQuote:
+		te.quoteDepth++
+	case sz.NameSymFormatSpan, sz.NameSymRegionBlock, sz.NameSymRegionQuote, sz.NameSymRegionVerse:
+	default:
+		return
+	}
+	if lst, isPair := sxpf.GetPair(attrVal); isPair {
+		if lang, found := sz.GetAttributes(lst).Get("lang"); found && lang != "" {
+			te.lang = lang
+		}
+	}
+}
+
+// transformQuoteMarks returns the content of a quote, enclosed in the
+// quotation marks of the given language, if there is a style for it.
+func (te *TransformEnv) transformQuoteMarks(content *sxpf.Pair, lang string) (*sxpf.Pair, bool) {
+	if len(te.tr.quoteStyles) == 0 {
+		return nil, false
+	}
+	if lang == "" {
+		lang = te.lang
+	}
+	style, found := te.tr.findQuoteStyle(lang)
+	if !found {
+		return nil, false
+	}
+	marks := style.marks(te.quoteDepth)
+	result := content.Cons(sxpf.MakeString(marks[0]))
+	result.LastPair().AppendBang(sxpf.MakeString(marks[1]))
+	return result, true
+}
+
+func (te *TransformEnv) makeLangAttr(lang string) *sxpf.Pair {
+	return sxpf.MakeList(te.symAttr, sxpf.Cons(te.Make("lang"), sxpf.MakeString(lang)))
+}
@@ -12,10 +12,17 @@
 package shtml
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"zettelstore.de/c/api"
 	"zettelstore.de/c/attrs"
@@ -25,17 +32,46 @@ import (
 	"zettelstore.de/sx.fossil/sxpf"
 	"zettelstore.de/sx.fossil/sxpf/builtins/quote"
 	"zettelstore.de/sx.fossil/sxpf/eval"
+	"zettelstore.de/sx.fossil/sxpf/reader"
 )
 
 // Transformer will transform a s-expression that encodes the zettel AST into an s-expression
 // that represents HTML.
+//
+// After it is configured, a transformer can be used concurrently by several
+// goroutines, if every goroutine uses its own Notes value, see TransformNotes,
+// and if the symbol factories of the ASTs are safe for concurrent use. The
+// methods Transform, Endnotes, and CitedKeys use a Notes value stored within
+// the transformer and must not be used concurrently.
 type Transformer struct {
 	sf            sxpf.SymbolFactory
+	astSF         sxpf.SymbolFactory // factory to read ASTs, see ReaderOptions
+	sfMx          sync.Mutex         // protects sf
+	envPool       sync.Pool          // environments for ASTs of astSF
 	rebinder      RebindProc
 	headingOffset int64
+	numbering     bool // true iff headings are numbered hierarchically
+	anchors       bool // true iff headings without a fragment get a synthesized id
 	unique        string
-	endnotes      []endnoteInfo
+	notes         Notes
+	citeHandler   CiteFunc
 	noLinks       bool // true iff output must not include links
+	linkData      bool // true iff links contain data attributes about their target
+	queryBase     string
+	footnotes     FootnoteMode
+	markHighlight bool // true iff marks are written as highlighted text
+	rubyKey       string
+	dropComments  bool // true iff comments are never written
+	useEntities   bool // true iff some special characters should be written as entities
+	sanitize      attrs.SanitizePolicy
+	dropEmpty     bool // true iff attributes with an empty value are omitted
+	quoteStyles   map[string]quoteStyle
+	assetURLFunc  AssetURLFunc
+	altTextFunc   AltTextFunc
+	evalHandler   EvalFunc
+	stats         *TransformStats
+	textSB        *strings.Builder
+	textVerbatim  bool // true iff the text collector gets verbatim code too
 	symAttr       *sxpf.Symbol
 	symClass      *sxpf.Symbol
 	symMeta       *sxpf.Symbol
@@ -43,10 +79,41 @@ type Transformer struct {
 	symSpan       *sxpf.Symbol
 }
 
+// Notes collects the endnotes and the citations found while transforming one
+// or more ASTs.
+type Notes struct {
+	endnotes       []endnoteInfo
+	citedKeys      []string
+	headingNumbers map[string]string
+	anchors        text.Anchors
+}
+
+// CitedKeys returns the keys of all citations in the order of their first
+// appearance.
+func (n *Notes) CitedKeys() []string { return n.citedKeys }
+
+// HeadingNumbers maps the fragment of every numbered heading to its number,
+// e.g. "2.3.1". See Transformer.SetHeadingNumbering.
+func (n *Notes) HeadingNumbers() map[string]string { return n.headingNumbers }
+
+func (n *Notes) addCitedKey(key string) {
+	for _, k := range n.citedKeys {
+		if k == key {
+			return
+		}
+	}
+	n.citedKeys = append(n.citedKeys, key)
+}
+
 type endnoteInfo struct {
-	noteAST *sxpf.Pair // Endnote as AST
-	noteHx  *sxpf.Pair // Endnote as SxHTML
-	attrs   *sxpf.Pair // attrs a-list
+	noteAST *sxpf.Pair       // Endnote as AST
+	noteHx  *sxpf.Pair       // Endnote as SxHTML
+	attrs   attrs.Attributes // attributes of the endnote
+	unique  string           // unique prefix when the endnote was found
+	noLinks bool             // noLinks setting when the endnote was found
+
+	quoteDepth int    // number of quotes that enclose the endnote
+	lang       string // language of the element that contains the endnote
 }
 
 // NewTransformer creates a new transformer object.
@@ -56,6 +123,7 @@ func NewTransformer(headingOffset int, sf sxpf.SymbolFactory) *Transformer {
 	}
 	return &Transformer{
 		sf:            sf,
+		astSF:         sxpf.MakeMappedFactory(),
 		rebinder:      nil,
 		headingOffset: int64(headingOffset),
 		symAttr:       sf.MustMake(sxhtml.NameSymAttr),
@@ -69,14 +137,181 @@ func NewTransformer(headingOffset int, sf sxpf.SymbolFactory) *Transformer {
 // SymbolFactory returns the symbol factory to create HTML symbols.
 func (tr *Transformer) SymbolFactory() sxpf.SymbolFactory { return tr.sf }
 
+// ASTSymbolFactory returns a symbol factory to create the symbols of an AST.
+// It is never the factory for HTML symbols.
+func (tr *Transformer) ASTSymbolFactory() sxpf.SymbolFactory { return tr.astSF }
+
+// ReaderOptions returns the options to read an AST that can be transformed,
+// e.g. reader.MakeReader(r, tr.ReaderOptions()...). Such ASTs are transformed
+// faster, because the transformation environments can be reused.
+func (tr *Transformer) ReaderOptions() []reader.Option {
+	return []reader.Option{reader.WithSymbolFactory(tr.astSF)}
+}
+
 // SetUnique sets a prefix to make several HTML ids unique.
 func (tr *Transformer) SetUnique(s string) { tr.unique = s }
 
+// SetNoLinks controls whether the output must not include links. Instead of a
+// link, only its text is written.
+func (tr *Transformer) SetNoLinks(b bool) { tr.noLinks = b }
+
+// SetLinkDataAttributes controls whether links carry data attributes about
+// their target, for client-side scripts: links to zettel get a "data-zid"
+// attribute with the zettel identifier, external links get a "data-external"
+// attribute.
+func (tr *Transformer) SetLinkDataAttributes(b bool) { tr.linkData = b }
+
+// SetQueryLinkBase sets the URL that is prefixed to the href of a query link.
+// By default, the base is empty, i.e. the query is relative to the current
+// page. A base may already contain query parameters, e.g. "/search?lang=en".
+func (tr *Transformer) SetQueryLinkBase(base string) { tr.queryBase = base }
+
+// queryHREF returns the href of a link to the given query.
+func (tr *Transformer) queryHREF(query string) string {
+	base := tr.queryBase
+	sep := "?"
+	if strings.HasSuffix(base, "?") || strings.HasSuffix(base, "&") {
+		sep = ""
+	} else if strings.IndexByte(base, '?') >= 0 {
+		sep = "&"
+	}
+	return base + sep + api.QueryKeyQuery + "=" + url.QueryEscape(query)
+}
+
+// FootnoteMode specifies how footnotes are transformed.
+type FootnoteMode uint8
+
+// Values for FootnoteMode.
+const (
+	FootnotesEndnote FootnoteMode = iota // Collect footnotes as endnotes, the default
+	FootnotesInline                      // Write footnotes in parentheses where they occur
+	FootnotesIgnore                      // Drop all footnotes
+)
+
+// SetFootnoteMode controls how footnotes are transformed. In inline mode, the
+// content of a footnote is written in parentheses within a span of class
+// "zs-footnote-inline". If footnotes are not transformed into endnotes,
+// Endnotes returns nil.
+func (tr *Transformer) SetFootnoteMode(mode FootnoteMode) { tr.footnotes = mode }
+
+// SetKeepComments controls whether comments are written, if they are marked
+// with the default attribute. If set to false, comments are never written. The
+// default is true.
+func (tr *Transformer) SetKeepComments(b bool) { tr.dropComments = !b }
+
+// SetRubyAttribute sets the attribute key of a span that contains a ruby
+// annotation, typically "ruby". A span with this attribute is written as a
+// "ruby" element, with the attribute value as its "rt" element. An empty key
+// disables ruby annotations, which is the default.
+func (tr *Transformer) SetRubyAttribute(key string) { tr.rubyKey = key }
+
+// SetMarkAsHighlight controls whether marked text is written as highlighted
+// text, i.e. as a "mark" element, instead of an anchor.
+func (tr *Transformer) SetMarkAsHighlight(b bool) { tr.markHighlight = b }
+
+// AssetURLFunc returns the URL of a zettel that is embedded as an asset, e.g.
+// as a SVG image. The extension is derived from the syntax of the zettel.
+type AssetURLFunc func(zid, ext string) string
+
+// SetAssetURLFunc sets the function to calculate the URL of embedded zettel.
+// If not set, or if set to nil, the URL is "/{zid}.{ext}".
+func (tr *Transformer) SetAssetURLFunc(fn AssetURLFunc) { tr.assetURLFunc = fn }
+
+func (tr *Transformer) assetURL(zid, ext string) string {
+	if fn := tr.assetURLFunc; fn != nil {
+		return fn(zid, ext)
+	}
+	return "/" + zid + "." + ext
+}
+
+// AltTextFunc returns the alternative text of an embedded image, e.g. the
+// title of the zettel with the given reference.
+type AltTextFunc func(ref string) string
+
+// SetAltTextProvider sets the function to calculate the alternative text of
+// embedded images without a description. If there is no such function, or if it
+// returns an empty string, the alternative text is empty, so that screen readers
+// skip the image.
+func (tr *Transformer) SetAltTextProvider(fn AltTextFunc) { tr.altTextFunc = fn }
+
+// EvalFunc transforms the content of a verbatim eval block, e.g. a diagram
+// description, into a HTML s-expression. If it returns neither a result nor
+// an error, the block is transformed as if no function was set.
+type EvalFunc func(a attrs.Attributes, code string) (*sxpf.Pair, error)
+
+// SetEvalHandler sets the function to transform verbatim eval blocks. If the
+// function returns an error, the block is transformed as if no function was
+// set, but with an additional class "zs-eval-error", and it is preceded by a
+// comment containing the error message.
+func (tr *Transformer) SetEvalHandler(fn EvalFunc) { tr.evalHandler = fn }
+
+// SetHeadingNumbering controls whether headings are numbered hierarchically,
+// e.g. "2.3.1". The number depends on the level of the heading within the
+// zettel, not on the heading offset. A skipped level is counted as zero.
+func (tr *Transformer) SetHeadingNumbering(b bool) { tr.numbering = b }
+
+// SetHeadingAnchors controls whether a heading without a fragment gets an id
+// that is synthesized from its text, see text.AnchorFor. A Zettelstore omits
+// the fragment, if the heading contains no ASCII letters or digits, e.g. for
+// CJK text. Synthesized ids are unique within the notes of the transformation.
+func (tr *Transformer) SetHeadingAnchors(b bool) { tr.anchors = b }
+
+// HeadingNumbers returns the numbers of all headings, if headings are numbered.
+// The numbers are cleared when the endnotes are retrieved.
+func (tr *Transformer) HeadingNumbers() map[string]string { return tr.notes.HeadingNumbers() }
+
+// SetTextCollector sets a builder that collects the plain text of all ASTs
+// that are transformed afterwards, in the same pass. The text is the same as
+// the result of text.Encoder, i.e. endnotes are not included. If verbatim is
+// true, the content of inline and block program code is collected too. A nil
+// builder stops the collection. Since the builder is not safe for concurrent
+// use, the transformer must not be used concurrently while text is collected.
+func (tr *Transformer) SetTextCollector(sb *strings.Builder, verbatim bool) {
+	tr.textSB = sb
+	tr.textVerbatim = verbatim
+}
+
+// SetStatsCollector sets the value to collect statistics of all following
+// transformations. A nil value stops collecting statistics.
+func (tr *Transformer) SetStatsCollector(stats *TransformStats) { tr.stats = stats }
+
+// SetEntities controls whether soft hyphens and non-breaking spaces within text
+// are written as HTML entity references.
+func (tr *Transformer) SetEntities(b bool) { tr.useEntities = b }
+
+// SetSanitizePolicy lets the transformer remove all attributes that are not
+// allowed by the given policy, e.g. attrs.DefaultSanitizePolicy. A nil policy
+// disables sanitizing, which is the default.
+func (tr *Transformer) SetSanitizePolicy(policy attrs.SanitizePolicy) { tr.sanitize = policy }
+
+// SetDropEmpty controls whether attributes with an empty value are omitted.
+func (tr *Transformer) SetDropEmpty(b bool) { tr.dropEmpty = b }
+
+// CiteFunc transforms a citation into a HTML s-expression. The inline list
+// contains the already transformed text of the citation. If the function
+// returns nil, the default transformation is used.
+type CiteFunc func(key string, a attrs.Attributes, inline *sxpf.Pair) *sxpf.Pair
+
+// SetCiteHandler sets the function to transform citations.
+func (tr *Transformer) SetCiteHandler(fn CiteFunc) { tr.citeHandler = fn }
+
+// CitedKeys returns the keys of all citations in the order of their first
+// appearance. The keys are cleared when the endnotes are retrieved.
+func (tr *Transformer) CitedKeys() []string { return tr.notes.CitedKeys() }
+
 // IsValidName returns true, if name is a valid symbol name.
-func (tr *Transformer) IsValidName(s string) bool { return tr.sf.IsValidName(s) }
+func (tr *Transformer) IsValidName(s string) bool {
+	tr.sfMx.Lock()
+	defer tr.sfMx.Unlock()
+	return tr.sf.IsValidName(s)
+}
 
 // Make a new HTML symbol.
-func (tr *Transformer) Make(s string) *sxpf.Symbol { return tr.sf.MustMake(s) }
+func (tr *Transformer) Make(s string) *sxpf.Symbol {
+	tr.sfMx.Lock()
+	defer tr.sfMx.Unlock()
+	return tr.sf.MustMake(s)
+}
 
 // RebindProc is a procedure which is called every time before a tranformation takes place.
 type RebindProc func(*TransformEnv)
@@ -85,16 +320,31 @@ type RebindProc func(*TransformEnv)
 func (tr *Transformer) SetRebinder(rb RebindProc) { tr.rebinder = rb }
 
 // TransformAttrbute transforms the given attributes into a HTML s-expression.
+//
+// Deprecated: use TransformAttribute instead.
 func (tr *Transformer) TransformAttrbute(a attrs.Attributes) *sxpf.Pair {
+	return tr.TransformAttribute(a)
+}
+
+// TransformAttribute transforms the given attributes into a HTML s-expression.
+// Attributes are sorted by their key, so that the result is deterministic.
+func (tr *Transformer) TransformAttribute(a attrs.Attributes) *sxpf.Pair {
 	if len(a) == 0 {
 		return nil
 	}
+	if policy := tr.sanitize; policy != nil {
+		a = attrs.Sanitize(a, policy)
+	}
 	plist := sxpf.Nil()
 	keys := a.Keys()
 	for i := len(keys) - 1; i >= 0; i-- {
 		key := keys[i]
+		val := a[key]
+		if tr.dropEmpty && val == "" {
+			continue
+		}
 		if key != attrs.DefaultAttribute && tr.IsValidName(key) {
-			plist = plist.Cons(sxpf.Cons(tr.Make(key), sxpf.MakeString(a[key])))
+			plist = plist.Cons(sxpf.Cons(tr.Make(key), sxpf.MakeString(val)))
 		}
 	}
 	if plist == nil {
@@ -105,98 +355,169 @@ func (tr *Transformer) TransformAttrbute(a attrs.Attributes) *sxpf.Pair {
 
 // TransformMeta creates a HTML meta s-expression
 func (tr *Transformer) TransformMeta(a attrs.Attributes) *sxpf.Pair {
-	return sxpf.Nil().Cons(tr.TransformAttrbute(a)).Cons(tr.symMeta)
+	return sxpf.Nil().Cons(tr.TransformAttribute(a)).Cons(tr.symMeta)
 }
 
-// Transform an AST s-expression into a list of HTML s-expressions.
+// Transform an AST s-expression into a list of HTML s-expressions. Endnotes
+// and citations are collected within the transformer, until Endnotes is
+// called.
 func (tr *Transformer) Transform(lst *sxpf.Pair) (*sxpf.Pair, error) {
+	return tr.TransformNotes(lst, &tr.notes)
+}
+
+// ErrInvalidSymbolFactory is returned, if the symbols of an AST were created
+// by the symbol factory for HTML symbols. Read the AST with the options of
+// ReaderOptions to prevent this.
+var ErrInvalidSymbolFactory = errors.New("AST uses the symbol factory of the HTML transformer")
+
+// TransformNotes transforms an AST s-expression into a list of HTML
+// s-expressions, like Transform. Endnotes and citations are collected in the
+// given Notes value.
+func (tr *Transformer) TransformNotes(lst *sxpf.Pair, notes *Notes) (*sxpf.Pair, error) {
 	astSF := sxpf.FindSymbolFactory(lst)
-	if astSF != nil {
-		if astSF == tr.sf {
-			panic("Invalid AST SymbolFactory")
-		}
-	} else {
-		astSF = sxpf.MakeMappedFactory()
+	if astSF == tr.sf && astSF != nil {
+		return nil, ErrInvalidSymbolFactory
 	}
-	astEnv := sxpf.MakeRootEnvironment()
-	engine := eval.MakeEngine(astSF, astEnv)
-	quote.InstallQuoteSyntax(astEnv, astSF.MustMake(sz.NameSymQuote))
-	te := TransformEnv{
-		tr:      tr,
-		astSF:   astSF,
-		astEnv:  astEnv,
-		err:     nil,
-		textEnc: text.NewEncoder(astSF),
+	te := tr.getEnv(astSF)
+	defer tr.putEnv(te)
+	te.notes = notes
+	te.textSB = tr.textSB
+	if stats := tr.stats; stats != nil {
+		te.counts = map[string]int{}
+		start := time.Now()
+		defer func() { stats.add(te.counts, time.Since(start)) }()
 	}
-	te.initialize()
 	if rb := tr.rebinder; rb != nil {
-		rb(&te)
+		rb(te)
 	}
 
-	val, err := engine.Eval(te.astEnv, lst)
+	val, err := te.evaluate(lst)
 	if err != nil {
 		return nil, err
 	}
 	res, isPair := sxpf.GetPair(val)
 	if !isPair {
-		panic("Result is not a list")
+		return nil, fmt.Errorf("result is not a list: %v", val)
 	}
-	for i := 0; i < len(tr.endnotes); i++ {
-		// May extend tr.endnotes
-		val, err = engine.Eval(te.astEnv, tr.endnotes[i].noteAST)
+	te.textSB = nil // Text of endnotes is not collected, as with text.Encoder
+	for i := 0; i < len(notes.endnotes); i++ {
+		// May extend notes.endnotes
+		te.quoteDepth, te.lang = notes.endnotes[i].quoteDepth, notes.endnotes[i].lang
+		val, err = te.evaluate(notes.endnotes[i].noteAST)
 		if err != nil {
 			return res, err
 		}
 		en, ok := sxpf.GetPair(val)
 		if !ok {
-			panic("Endnote is not a list")
+			return res, fmt.Errorf("endnote is not a list: %v", val)
 		}
-		tr.endnotes[i].noteHx = en
+		notes.endnotes[i].noteHx = en
 	}
 	return res, err
 
 }
 
-// Endnotes returns a SHTML object with all collected endnotes.
-func (tr *Transformer) Endnotes() *sxpf.Pair {
-	if len(tr.endnotes) == 0 {
+// getEnv returns an environment to transform an AST with the given symbol
+// factory. Binding all transformation functions is costly, therefore
+// environments are reused, if they were not changed by a rebinder. Only
+// environments for ASTs read with ReaderOptions are reused, because other
+// factories are often created for a single document. Pooling them would keep
+// every factory alive.
+func (tr *Transformer) getEnv(astSF sxpf.SymbolFactory) *TransformEnv {
+	if astSF != tr.astSF || tr.rebinder != nil {
+		if astSF == nil {
+			astSF = sxpf.MakeMappedFactory()
+		}
+		return tr.newEnv(astSF)
+	}
+	if te, ok := tr.envPool.Get().(*TransformEnv); ok {
+		te.pooled = true
+		return te
+	}
+	te := tr.newEnv(astSF)
+	te.pooled = true
+	return te
+}
+
+func (tr *Transformer) newEnv(astSF sxpf.SymbolFactory) *TransformEnv {
+	astEnv := sxpf.MakeRootEnvironment()
+	quote.InstallQuoteSyntax(astEnv, astSF.MustMake(sz.NameSymQuote))
+	te := &TransformEnv{
+		tr:      tr,
+		astSF:   astSF,
+		astEnv:  astEnv,
+		engine:  eval.MakeEngine(astSF, astEnv),
+		textEnc: text.NewEncoder(astSF),
+	}
+	te.initialize()
+	return te
+}
+
+// putEnv resets the per-call state of the environment and makes it available
+// for the next transformation.
+func (tr *Transformer) putEnv(te *TransformEnv) {
+	if !te.pooled {
+		return
+	}
+	te.pooled = false
+	te.notes = nil
+	te.err = nil
+	te.headingNums = te.headingNums[:0]
+	te.counts = nil
+	te.textSB = nil
+	te.quoteDepth = 0
+	te.lang = ""
+	tr.envPool.Put(te)
+}
+
+// Endnotes returns a SHTML object with all endnotes collected by Transform.
+func (tr *Transformer) Endnotes() *sxpf.Pair { return tr.EndnotesOf(&tr.notes) }
+
+// EndnotesOf returns a SHTML object with all endnotes of the given Notes value.
+// Afterwards, the Notes value is empty.
+func (tr *Transformer) EndnotesOf(notes *Notes) *sxpf.Pair {
+	defer func() { *notes = Notes{} }()
+	if len(notes.endnotes) == 0 || tr.footnotes != FootnotesEndnote {
 		return nil
 	}
 	result := sxpf.Nil().Cons(tr.Make("ol"))
 	currResult := result.AppendBang(sxpf.Nil().Cons(sxpf.Cons(tr.symClass, sxpf.MakeString("zs-endnotes"))).Cons(tr.symAttr))
-	for i, fni := range tr.endnotes {
+	for i, fni := range notes.endnotes {
 		noteNum := strconv.Itoa(i + 1)
-		noteID := tr.unique + noteNum
-
-		attrs := fni.attrs.Cons(sxpf.Cons(tr.symClass, sxpf.MakeString("zs-endnote"))).
-			Cons(sxpf.Cons(tr.Make("value"), sxpf.MakeString(noteNum))).
-			Cons(sxpf.Cons(tr.Make("id"), sxpf.MakeString("fn:"+noteID))).
-			Cons(sxpf.Cons(tr.Make("role"), sxpf.MakeString("doc-endnote"))).
-			Cons(tr.symAttr)
-
-		backref := sxpf.Nil().Cons(sxpf.MakeString("\u21a9\ufe0e")).
-			Cons(sxpf.Nil().
-				Cons(sxpf.Cons(tr.symClass, sxpf.MakeString("zs-endnote-backref"))).
-				Cons(sxpf.Cons(tr.Make("href"), sxpf.MakeString("#fnref:"+noteID))).
-				Cons(sxpf.Cons(tr.Make("role"), sxpf.MakeString("doc-backlink"))).
-				Cons(tr.symAttr)).
-			Cons(tr.symA)
+		noteID := fni.unique + noteNum
+
+		a := fni.attrs.Clone().
+			Set("role", "doc-endnote").
+			Set("id", "fn:"+noteID).
+			Set("value", noteNum).
+			AddClass("zs-endnote")
 
 		li := sxpf.Nil().Cons(tr.Make("li"))
-		li.AppendBang(attrs).
-			ExtendBang(fni.noteHx).
-			AppendBang(sxpf.MakeString(" ")).AppendBang(backref)
+		last := li.AppendBang(tr.TransformAttribute(a)).ExtendBang(fni.noteHx)
+		if !fni.noLinks {
+			backrefAttr := attrs.Attributes{
+				"class": "zs-endnote-backref",
+				"href":  "#fnref:" + noteID,
+				"role":  "doc-backlink",
+			}
+			backref := sxpf.Nil().Cons(sxpf.MakeString("\u21a9\ufe0e")).
+				Cons(tr.TransformAttribute(backrefAttr)).
+				Cons(tr.symA)
+			last.AppendBang(sxpf.MakeString(" ")).AppendBang(backref)
+		}
 		currResult = currResult.AppendBang(li)
 	}
-	tr.endnotes = nil
 	return result
 }
 
 // TransformEnv is the environment where the actual transformation takes places.
 type TransformEnv struct {
 	tr          *Transformer
+	notes       *Notes
 	astSF       sxpf.SymbolFactory
 	astEnv      sxpf.Environment
+	engine      *eval.Engine
+	pooled      bool // true iff the environment is returned to the pool of the transformer
 	err         error
 	textEnc     *text.Encoder
 	symNoEscape *sxpf.Symbol
@@ -204,6 +525,12 @@ type TransformEnv struct {
 	symA        *sxpf.Symbol
 	symSpan     *sxpf.Symbol
 	symP        *sxpf.Symbol
+	headingNums []int            // counters of the heading levels, if headings are numbered
+	counts      map[string]int   // number of transformed nodes by type, if statistics are collected
+	textSB      *strings.Builder // collects the plain text, if not nil
+	symSplice   *sxpf.Symbol     // marks a list of block elements, see makeSplice
+	quoteDepth  int              // number of quotes that enclose the current element
+	lang        string           // language of the current element, if quotes have a style
 }
 
 func (te *TransformEnv) initialize() {
@@ -212,6 +539,7 @@ func (te *TransformEnv) initialize() {
 	te.symA = te.tr.symA
 	te.symSpan = te.tr.symSpan
 	te.symP = te.Make("p")
+	te.symSplice = sxpf.MakeMappedFactory().MustMake("splice")
 
 	te.bind(sz.NameSymList, 0, listArgs)
 	te.bindMetadata()
@@ -263,8 +591,42 @@ func (te *TransformEnv) bindMetadata() {
 	te.bind(sz.NameSymTypeWordSet, 2, metaSet)
 }
 
+// headingNumber counts a heading of the given level and returns its number.
+func (te *TransformEnv) headingNumber(level int, fragment string) string {
+	for len(te.headingNums) < level {
+		te.headingNums = append(te.headingNums, 0)
+	}
+	te.headingNums = te.headingNums[:level]
+	te.headingNums[level-1]++
+	nums := make([]string, level)
+	for i, n := range te.headingNums {
+		nums[i] = strconv.Itoa(n)
+	}
+	num := strings.Join(nums, ".")
+	if fragment != "" {
+		if te.notes.headingNumbers == nil {
+			te.notes.headingNumbers = make(map[string]string)
+		}
+		te.notes.headingNumbers[fragment] = num
+	}
+	return num
+}
+
 func (te *TransformEnv) bindBlocks() {
-	te.bind(sz.NameSymBlock, 0, listArgs)
+	te.bind(sz.NameSymBlock, 0, func(args []sxpf.Object) sxpf.Object {
+		// A block element may be transformed into several HTML elements, e.g.
+		// a comment and the element itself, see makeSplice.
+		result := sxpf.Nil().Cons(sxpf.Nil())
+		curr := result
+		for _, arg := range args {
+			if elems, isPair := sxpf.GetPair(arg); isPair && elems != nil && te.symSplice.IsEqual(elems.Car()) {
+				curr = curr.ExtendBang(elems.Tail())
+				continue
+			}
+			curr = curr.AppendBang(arg)
+		}
+		return result.Tail()
+	})
 	te.bind(sz.NameSymPara, 0, func(args []sxpf.Object) sxpf.Object {
 		// for ; args != nil; args = args.Tail() {
 		// 	lst, ok := sxpf.GetList(args.Car())
@@ -283,24 +645,39 @@ func (te *TransformEnv) bindBlocks() {
 		level := strconv.FormatInt(nLevel+te.tr.headingOffset, 10)
 
 		a := te.getAttributes(args[1])
-		if fragment := te.getString(args[3]).String(); fragment != "" {
-			a = a.Set("id", te.tr.unique+fragment)
-		}
-
-		if result, isPair := sxpf.GetPair(args[4]); isPair && result != nil {
-			if len(a) > 0 {
-				result = result.Cons(te.transformAttribute(a))
+		fragment := te.getString(args[3]).String()
+		result, isPair := sxpf.GetPair(args[4])
+		if !isPair || result == nil {
+			result = sxpf.MakeList(sxpf.MakeString("<MISSING TEXT>"))
+			a = nil
+		} else {
+			if te.tr.anchors {
+				if fragment == "" {
+					var sb strings.Builder
+					te.flattenText(&sb, result)
+					fragment = te.notes.anchors.Make(sb.String())
+				} else {
+					te.notes.anchors.Add(fragment)
+				}
 			}
-			return result.Cons(te.Make("h" + level))
+			if fragment != "" {
+				a = a.Set("id", te.tr.unique+fragment)
+			}
+		}
+		if te.tr.numbering {
+			num := te.headingNumber(int(nLevel), fragment)
+			result = result.Cons(sxpf.MakeString(" ")).Cons(sxpf.MakeList(
+				te.symSpan,
+				sxpf.MakeList(te.symAttr, sxpf.Cons(te.tr.symClass, sxpf.MakeString("zs-heading-number"))),
+				sxpf.MakeString(num),
+			))
 		}
-		return sxpf.MakeList(te.Make("h"+level), sxpf.MakeString("<MISSING TEXT>"))
+		return te.consAttributes(result, a).Cons(te.Make("h" + level))
 	})
 	te.bind(sz.NameSymThematic, 0, func(args []sxpf.Object) sxpf.Object {
 		result := sxpf.Nil()
 		if len(args) > 0 {
-			if attrList := te.getList(args[0]); attrList != nil {
-				result = result.Cons(te.transformAttribute(sz.GetAttributes(attrList)))
-			}
+			result = te.consAttributes(result, te.getAttributes(args[0]))
 		}
 		return result.Cons(te.Make("hr"))
 	})
@@ -382,7 +759,7 @@ func (te *TransformEnv) bindBlocks() {
 	te.bind(sz.NameSymRegionVerse, 2, te.makeRegionFn(te.Make("div"), false))
 
 	te.bind(sz.NameSymVerbatimComment, 1, func(args []sxpf.Object) sxpf.Object {
-		if te.getAttributes(args[0]).HasDefault() {
+		if !te.tr.dropComments && te.getAttributes(args[0]).HasDefault() {
 			if len(args) > 1 {
 				if s := te.getString(args[1]); s != "" {
 					t := sxpf.MakeString(s.String())
@@ -394,7 +771,24 @@ func (te *TransformEnv) bindBlocks() {
 	})
 
 	te.bind(sz.NameSymVerbatimEval, 2, func(args []sxpf.Object) sxpf.Object {
-		return te.transformVerbatim(te.getAttributes(args[0]).AddClass("zs-eval"), te.getString(args[1]))
+		a, code := te.getAttributes(args[0]), te.getString(args[1])
+		handler := te.tr.evalHandler
+		if handler == nil {
+			return te.transformVerbatim(a.AddClass("zs-eval"), code)
+		}
+		result, err := handler(a.Clone(), code.String())
+		if err == nil {
+			if result == nil {
+				return te.transformVerbatim(a.AddClass("zs-eval"), code)
+			}
+			return result
+		}
+		pre := te.transformVerbatim(a.AddClass("zs-eval").AddClass("zs-eval-error"), code)
+		if te.tr.dropComments {
+			return pre
+		}
+		comment := sxpf.MakeList(te.Make(sxhtml.NameSymBlockComment), sxpf.MakeString(commentText(err.Error())))
+		return te.makeSplice(comment, pre)
 	})
 	te.bind(sz.NameSymVerbatimHTML, 2, te.transformHTML)
 	te.bind(sz.NameSymVerbatimMath, 2, func(args []sxpf.Object) sxpf.Object {
@@ -403,6 +797,10 @@ func (te *TransformEnv) bindBlocks() {
 	te.bind(sz.NameSymVerbatimProg, 2, func(args []sxpf.Object) sxpf.Object {
 		a := te.getAttributes(args[0])
 		content := te.getString(args[1])
+		if te.tr.textVerbatim {
+			te.collectText(content.String())
+			te.collectText("\n")
+		}
 		if a.HasDefault() {
 			content = sxpf.MakeString(visibleReplacer.Replace(content.String()))
 		}
@@ -411,7 +809,7 @@ func (te *TransformEnv) bindBlocks() {
 	te.bind(sz.NameSymVerbatimZettel, 0, func([]sxpf.Object) sxpf.Object { return sxpf.Nil() })
 
 	te.bind(sz.NameSymBLOB, 3, func(args []sxpf.Object) sxpf.Object {
-		return te.transformBLOB(te.getList(args[0]), te.getString(args[1]), te.getString(args[2]))
+		return te.transformBLOB(nil, te.getList(args[0]), te.getString(args[1]), te.getString(args[2]))
 	})
 
 	te.bind(sz.NameSymTransclude, 2, func(args []sxpf.Object) sxpf.Object {
@@ -485,11 +883,7 @@ func (te *TransformEnv) makeRegionFn(sym *sxpf.Symbol, genericToClass bool) tran
 				a = a.Remove("").AddClass(val)
 			}
 		}
-		result := sxpf.Nil()
-		if len(a) > 0 {
-			result = result.Cons(te.transformAttribute(a))
-		}
-		result = result.Cons(sym)
+		result := te.consAttributes(sxpf.Nil(), a).Cons(sym)
 		currResult := result.LastPair()
 		if region, isPair := sxpf.GetPair(args[1]); isPair {
 			currResult = currResult.ExtendBang(region)
@@ -503,31 +897,49 @@ func (te *TransformEnv) makeRegionFn(sym *sxpf.Symbol, genericToClass bool) tran
 	}
 }
 
-func (te *TransformEnv) transformVerbatim(a attrs.Attributes, s sxpf.String) sxpf.Object {
+// makeSplice returns a list of HTML elements that replaces one block element.
+// It is spliced into the enclosing block. The marker symbol is made by its own
+// symbol factory, so that it is never confused with a symbol of an AST or of
+// HTML.
+func (te *TransformEnv) makeSplice(elems ...sxpf.Object) *sxpf.Pair {
+	return sxpf.MakeList(elems...).Cons(te.symSplice)
+}
+
+func (te *TransformEnv) transformVerbatim(a attrs.Attributes, s sxpf.String) *sxpf.Pair {
 	a = setProgLang(a)
-	code := sxpf.Nil().Cons(s)
-	if al := te.transformAttribute(a); al != nil {
-		code = code.Cons(al)
-	}
-	code = code.Cons(te.Make("code"))
+	code := te.consAttributes(sxpf.Nil().Cons(s), a).Cons(te.Make("code"))
 	return sxpf.Nil().Cons(code).Cons(te.Make("pre"))
 }
 
 func (te *TransformEnv) bindInlines() {
 	te.bind(sz.NameSymInline, 0, listArgs)
-	te.bind(sz.NameSymText, 1, func(args []sxpf.Object) sxpf.Object { return te.getString(args[0]) })
+	te.bind(sz.NameSymText, 1, func(args []sxpf.Object) sxpf.Object {
+		s := te.getString(args[0])
+		te.collectText(s.String())
+		return te.transformText(s)
+	})
 	te.bind(sz.NameSymSpace, 0, func(args []sxpf.Object) sxpf.Object {
+		te.collectText(" ")
 		if len(args) == 0 {
 			return sxpf.MakeString(" ")
 		}
 		return te.getString(args[0])
 	})
-	te.bind(sz.NameSymSoft, 0, func([]sxpf.Object) sxpf.Object { return sxpf.MakeString(" ") })
+	te.bind(sz.NameSymSoft, 0, func([]sxpf.Object) sxpf.Object {
+		te.collectText(" ")
+		return sxpf.MakeString(" ")
+	})
 	brSym := te.Make("br")
-	te.bind(sz.NameSymHard, 0, func([]sxpf.Object) sxpf.Object { return sxpf.Nil().Cons(brSym) })
+	te.bind(sz.NameSymHard, 0, func(args []sxpf.Object) sxpf.Object {
+		te.collectText("\n")
+		result := sxpf.Nil()
+		if len(args) > 0 {
+			result = te.consAttributes(result, te.getAttributes(args[0]))
+		}
+		return result.Cons(brSym)
+	})
 
 	te.bind(sz.NameSymLinkInvalid, 2, func(args []sxpf.Object) sxpf.Object {
-		// a := te.getAttributes(args)
 		var inline *sxpf.Pair
 		if len(args) > 2 {
 			inline = sxpf.MakeList(args[2:]...)
@@ -535,16 +947,27 @@ func (te *TransformEnv) bindInlines() {
 		if inline == nil {
 			inline = sxpf.Nil().Cons(args[1])
 		}
-		return inline.Cons(te.symSpan)
+		return te.consAttributes(inline, te.getAttributes(args[0])).Cons(te.symSpan)
 	})
 	transformHREF := func(args []sxpf.Object) sxpf.Object {
 		a := te.getAttributes(args[0])
 		refValue := te.getString(args[1])
 		return te.transformLink(a.Set("href", refValue.String()), refValue, args[2:])
 	}
-	te.bind(sz.NameSymLinkZettel, 2, transformHREF)
-	te.bind(sz.NameSymLinkSelf, 2, transformHREF)
-	te.bind(sz.NameSymLinkFound, 2, transformHREF)
+	transformZettelHREF := func(args []sxpf.Object) sxpf.Object {
+		a := te.getAttributes(args[0])
+		refValue := te.getString(args[1])
+		a = a.Set("href", refValue.String())
+		if te.tr.linkData {
+			if zid := refZid(refValue.String()); zid.IsValid() {
+				a = a.Set("data-zid", string(zid))
+			}
+		}
+		return te.transformLink(a, refValue, args[2:])
+	}
+	te.bind(sz.NameSymLinkZettel, 2, transformZettelHREF)
+	te.bind(sz.NameSymLinkSelf, 2, transformZettelHREF)
+	te.bind(sz.NameSymLinkFound, 2, transformZettelHREF)
 	te.bind(sz.NameSymLinkBroken, 2, func(args []sxpf.Object) sxpf.Object {
 		a := te.getAttributes(args[0])
 		refValue := te.getString(args[1])
@@ -555,62 +978,74 @@ func (te *TransformEnv) bindInlines() {
 	te.bind(sz.NameSymLinkQuery, 2, func(args []sxpf.Object) sxpf.Object {
 		a := te.getAttributes(args[0])
 		refValue := te.getString(args[1])
-		query := "?" + api.QueryKeyQuery + "=" + url.QueryEscape(refValue.String())
-		return te.transformLink(a.Set("href", query), refValue, args[2:])
+		return te.transformLink(a.Set("href", te.tr.queryHREF(refValue.String())), refValue, args[2:])
 	})
 	te.bind(sz.NameSymLinkExternal, 2, func(args []sxpf.Object) sxpf.Object {
 		a := te.getAttributes(args[0])
 		refValue := te.getString(args[1])
-		return te.transformLink(a.Set("href", refValue.String()).AddClass("external"), refValue, args[2:])
+		a = a.Set("href", refValue.String()).AddClass("external")
+		if te.tr.linkData {
+			a = a.Set("data-external", api.ValueTrue)
+		}
+		return te.transformLink(a, refValue, args[2:])
 	})
 
 	te.bind(sz.NameSymEmbed, 3, func(args []sxpf.Object) sxpf.Object {
 		ref := te.getList(args[1])
 		syntax := te.getString(args[2])
 		if syntax == api.ValueSyntaxSVG {
-			embedAttr := sxpf.MakeList(
-				te.symAttr,
-				sxpf.Cons(te.Make("type"), sxpf.MakeString("image/svg+xml")),
-				sxpf.Cons(te.Make("src"), sxpf.MakeString("/"+te.getString(ref.Tail()).String()+".svg")),
-			)
+			a := te.getAttributes(args[0]).
+				Set("type", "image/svg+xml").
+				Set("src", te.tr.assetURL(te.getString(ref.Tail().Car()).String(), syntax.String()))
 			return sxpf.MakeList(
 				te.Make("figure"),
 				sxpf.MakeList(
 					te.Make("embed"),
-					embedAttr,
+					te.transformAttribute(a),
 				),
 			)
 		}
+		refValue := te.getString(ref.Tail().Car()).String()
 		a := te.getAttributes(args[0])
-		a = a.Set("src", string(te.getString(ref.Tail().Car())))
-		var sb strings.Builder
-		te.flattenText(&sb, ref.Tail().Tail().Tail())
-		if d := sb.String(); d != "" {
-			a = a.Set("alt", d)
+		a = a.Set("src", refValue)
+		if _, found := a.Get("alt"); !found {
+			var sb strings.Builder
+			te.flattenText(&sb, sxpf.MakeList(args[3:]...))
+			alt := sb.String()
+			if fn := te.tr.altTextFunc; alt == "" && fn != nil {
+				alt = fn(refValue)
+			}
+			a = a.Set("alt", alt)
 		}
 		return sxpf.MakeList(te.Make("img"), te.transformAttribute(a))
 	})
 	te.bind(sz.NameSymEmbedBLOB, 3, func(args []sxpf.Object) sxpf.Object {
 		a, syntax, data := te.getAttributes(args[0]), te.getString(args[1]), te.getString(args[2])
-		summary, _ := a.Get(api.KeySummary)
-		return te.transformBLOB(
-			sxpf.MakeList(te.astSF.MustMake(sz.NameSymInline), sxpf.MakeString(summary)),
-			syntax,
-			data,
-		)
+		var description *sxpf.Pair
+		if summary, found := a.Get(api.KeySummary); found && summary != "" {
+			description = sxpf.MakeList(sxpf.MakeString(summary))
+		}
+		return te.transformBLOB(a.Remove(api.KeySummary), description, syntax, data)
 	})
 
 	te.bind(sz.NameSymCite, 2, func(args []sxpf.Object) sxpf.Object {
+		key := te.getString(args[1])
+		if key != "" {
+			te.notes.addCitedKey(key.String())
+			if citeFn := te.tr.citeHandler; citeFn != nil {
+				if res := citeFn(key.String(), te.getAttributes(args[0]), sxpf.MakeList(args[2:]...)); res != nil {
+					return res
+				}
+			}
+		}
 		result := sxpf.Nil()
-		if key := te.getString(args[1]); key != "" {
+		if key != "" {
 			if len(args) > 2 {
 				result = sxpf.MakeList(args[2:]...).Cons(sxpf.MakeString(", "))
 			}
 			result = result.Cons(key)
 		}
-		if a := te.getAttributes(args[0]); len(a) > 0 {
-			result = result.Cons(te.transformAttribute(a))
-		}
+		result = te.consAttributes(result, te.getAttributes(args[0]))
 		if result == nil {
 			return nil
 		}
@@ -619,36 +1054,53 @@ func (te *TransformEnv) bindInlines() {
 
 	te.bind(sz.NameSymMark, 3, func(args []sxpf.Object) sxpf.Object {
 		result := sxpf.MakeList(args[3:]...)
+		var a attrs.Attributes
 		if !te.tr.noLinks {
 			if fragment := te.getString(args[2]); fragment != "" {
-				a := attrs.Attributes{"id": fragment.String() + te.tr.unique}
-				return result.Cons(te.transformAttribute(a)).Cons(te.symA)
+				a = a.Set("id", te.tr.unique+fragment.String())
 			}
 		}
+		if te.tr.markHighlight {
+			return te.consAttributes(result, a.AddClass("zs-mark")).Cons(te.Make("mark"))
+		}
+		if a != nil {
+			return result.Cons(te.transformAttribute(a)).Cons(te.symA)
+		}
 		return result.Cons(te.symSpan)
 	})
 
 	te.bind(sz.NameSymEndnote, 1, func(args []sxpf.Object) sxpf.Object {
-		attrPlist := sxpf.Nil()
-		if a := te.getAttributes(args[0]); len(a) > 0 {
-			if attrs := te.transformAttribute(a); attrs != nil {
-				attrPlist = attrs.Tail()
-			}
-		}
-
 		text, isPair := sxpf.GetPair(args[1])
 		if !isPair {
 			return sxpf.Nil()
 		}
-		te.tr.endnotes = append(te.tr.endnotes, endnoteInfo{noteAST: text, noteHx: nil, attrs: attrPlist})
-		noteNum := strconv.Itoa(len(te.tr.endnotes))
+		switch te.tr.footnotes {
+		case FootnotesIgnore:
+			return sxpf.Nil()
+		case FootnotesInline:
+			return te.transformInlineFootnote(te.getAttributes(args[0]), text)
+		}
+		te.notes.endnotes = append(te.notes.endnotes, endnoteInfo{
+			noteAST: text,
+			noteHx:  nil,
+			attrs:   te.getAttributes(args[0]),
+			unique:  te.tr.unique,
+			noLinks: te.tr.noLinks,
+
+			quoteDepth: te.quoteDepth,
+			lang:       te.lang,
+		})
+		noteNum := strconv.Itoa(len(te.notes.endnotes))
 		noteID := te.tr.unique + noteNum
+		supAttr := sxpf.Nil().Cons(sxpf.Cons(te.Make("id"), sxpf.MakeString("fnref:"+noteID))).Cons(te.symAttr)
+		if te.tr.noLinks {
+			return sxpf.Nil().Cons(sxpf.MakeString(noteNum)).Cons(supAttr).Cons(te.Make("sup"))
+		}
 		hrefAttr := sxpf.Nil().Cons(sxpf.Cons(te.Make("role"), sxpf.MakeString("doc-noteref"))).
 			Cons(sxpf.Cons(te.Make("href"), sxpf.MakeString("#fn:"+noteID))).
 			Cons(sxpf.Cons(te.tr.symClass, sxpf.MakeString("zs-noteref"))).
 			Cons(te.symAttr)
 		href := sxpf.Nil().Cons(sxpf.MakeString(noteNum)).Cons(hrefAttr).Cons(te.symA)
-		supAttr := sxpf.Nil().Cons(sxpf.Cons(te.Make("id"), sxpf.MakeString("fnref:"+noteID))).Cons(te.symAttr)
 		return sxpf.Nil().Cons(href).Cons(supAttr).Cons(te.Make("sup"))
 	})
 
@@ -656,13 +1108,13 @@ func (te *TransformEnv) bindInlines() {
 	te.bind(sz.NameSymFormatEmph, 1, te.makeFormatFn("em"))
 	te.bind(sz.NameSymFormatInsert, 1, te.makeFormatFn("ins"))
 	te.bind(sz.NameSymFormatQuote, 1, te.transformQuote)
-	te.bind(sz.NameSymFormatSpan, 1, te.makeFormatFn("span"))
+	te.bind(sz.NameSymFormatSpan, 1, te.makeSpanFn())
 	te.bind(sz.NameSymFormatStrong, 1, te.makeFormatFn("strong"))
 	te.bind(sz.NameSymFormatSub, 1, te.makeFormatFn("sub"))
 	te.bind(sz.NameSymFormatSuper, 1, te.makeFormatFn("sup"))
 
 	te.bind(sz.NameSymLiteralComment, 1, func(args []sxpf.Object) sxpf.Object {
-		if te.getAttributes(args[0]).HasDefault() {
+		if !te.tr.dropComments && te.getAttributes(args[0]).HasDefault() {
 			if len(args) > 1 {
 				if s := te.getString(args[1]); s != "" {
 					return sxpf.Nil().Cons(s).Cons(te.Make(sxhtml.NameSymInlineComment))
@@ -686,6 +1138,9 @@ func (te *TransformEnv) bindInlines() {
 		return te.transformLiteral(args, nil, sampSym)
 	})
 	te.bind(sz.NameSymLiteralProg, 2, func(args []sxpf.Object) sxpf.Object {
+		if te.tr.textVerbatim {
+			te.collectText(te.getString(args[1]).String())
+		}
 		return te.transformLiteral(args, nil, codeSym)
 	})
 
@@ -699,13 +1154,37 @@ func (te *TransformEnv) makeFormatFn(tag string) transformFn {
 		if val, found := a.Get(""); found {
 			a = a.Remove("").AddClass(val)
 		}
-		res := sxpf.MakeList(args[1:]...)
-		if len(a) > 0 {
-			res = res.Cons(te.transformAttribute(a))
+		return te.consAttributes(sxpf.MakeList(args[1:]...), a).Cons(sym)
+	}
+}
+func (te *TransformEnv) makeSpanFn() transformFn {
+	spanFn := te.makeFormatFn("span")
+	rubySym, rtSym := te.Make("ruby"), te.Make("rt")
+	return func(args []sxpf.Object) sxpf.Object {
+		key := te.tr.rubyKey
+		if key == "" {
+			return spanFn(args)
+		}
+		a := te.getAttributes(args[0])
+		rt, found := a.Get(key)
+		if !found {
+			return spanFn(args)
+		}
+		a = a.Remove(key)
+		if val, found2 := a.Get(""); found2 {
+			a = a.Remove("").AddClass(val)
+		}
+		content := sxpf.MakeList(args[1:]...)
+		annotation := sxpf.MakeList(rtSym, sxpf.MakeString(rt))
+		if content == nil {
+			content = sxpf.MakeList(annotation)
+		} else {
+			content.LastPair().AppendBang(annotation)
 		}
-		return res.Cons(sym)
+		return te.consAttributes(content, a).Cons(rubySym)
 	}
 }
+
 func (te *TransformEnv) transformQuote(args []sxpf.Object) sxpf.Object {
 	const langAttr = "lang"
 	a := te.getAttributes(args[0])
@@ -716,11 +1195,21 @@ func (te *TransformEnv) transformQuote(args []sxpf.Object) sxpf.Object {
 	if val, found2 := a.Get(""); found2 {
 		a = a.Remove("").AddClass(val)
 	}
-	res := sxpf.MakeList(args[1:]...)
-	if len(a) > 0 {
-		res = res.Cons(te.transformAttribute(a))
+	if content, hasMarks := te.transformQuoteMarks(sxpf.MakeList(args[1:]...), langVal); hasMarks {
+		attrList := te.transformAttribute(a)
+		if found {
+			langAttr := te.makeLangAttr(langVal)
+			if attrList != nil {
+				langAttr.LastPair().ExtendBang(attrList.Tail())
+			}
+			attrList = langAttr
+		}
+		if attrList != nil {
+			content = content.Cons(attrList)
+		}
+		return content.Cons(te.symSpan)
 	}
-	res = res.Cons(te.Make("q"))
+	res := te.consAttributes(sxpf.MakeList(args[1:]...), a).Cons(te.Make("q"))
 	if found {
 		res = sxpf.Nil().Cons(res).Cons(te.transformAttribute(attrs.Attributes{}.Set(langAttr, langVal))).Cons(te.symSpan)
 	}
@@ -729,6 +1218,62 @@ func (te *TransformEnv) transformQuote(args []sxpf.Object) sxpf.Object {
 
 var visibleReplacer = strings.NewReplacer(" ", "\u2423")
 
+// commentText returns the given string so that it can be used as the text of
+// a HTML comment: it must not contain "--" and must not end with "-". A space
+// is inserted after every hyphen that follows a hyphen, and after a trailing
+// hyphen.
+func commentText(s string) string {
+	if !strings.Contains(s, "-") {
+		return s
+	}
+	var sb strings.Builder
+	hyphen := false
+	for _, r := range s {
+		if r == '-' && hyphen {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(r)
+		hyphen = r == '-'
+	}
+	if hyphen {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// entityRunes maps some special characters to their HTML entity references.
+var entityRunes = map[rune]string{
+	'\u00a0': "&nbsp;",
+	'\u00ad': "&shy;",
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+func (te *TransformEnv) transformText(s sxpf.String) sxpf.Object {
+	if !te.tr.useEntities || strings.IndexFunc(s.String(), isEntityRune) < 0 {
+		return s
+	}
+	text := s.String()
+	var sb strings.Builder
+	for {
+		pos := strings.IndexFunc(text, isEntityRune)
+		if pos < 0 {
+			sb.WriteString(textEscaper.Replace(text))
+			break
+		}
+		sb.WriteString(textEscaper.Replace(text[:pos]))
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		sb.WriteString(entityRunes[r])
+		text = text[pos+size:]
+	}
+	return sxpf.Nil().Cons(sxpf.MakeString(sb.String())).Cons(te.symNoEscape)
+}
+
+func isEntityRune(r rune) bool {
+	_, found := entityRunes[r]
+	return found
+}
+
 func (te *TransformEnv) transformLiteral(args []sxpf.Object, a attrs.Attributes, sym *sxpf.Symbol) sxpf.Object {
 	if a == nil {
 		a = te.getAttributes(args[0])
@@ -739,11 +1284,7 @@ func (te *TransformEnv) transformLiteral(args []sxpf.Object, a attrs.Attributes,
 		a = a.RemoveDefault()
 		literal = visibleReplacer.Replace(literal)
 	}
-	res := sxpf.Nil().Cons(sxpf.MakeString(literal))
-	if len(a) > 0 {
-		res = res.Cons(te.transformAttribute(a))
-	}
-	return res.Cons(sym)
+	return te.consAttributes(sxpf.Nil().Cons(sxpf.MakeString(literal)), a).Cons(sym)
 }
 
 func setProgLang(a attrs.Attributes) attrs.Attributes {
@@ -753,6 +1294,32 @@ func setProgLang(a attrs.Attributes) attrs.Attributes {
 	return a
 }
 
+func (te *TransformEnv) transformInlineFootnote(a attrs.Attributes, text *sxpf.Pair) sxpf.Object {
+	textSB := te.textSB
+	te.textSB = nil
+	val, err := te.evaluate(text)
+	te.textSB = textSB
+	if err != nil {
+		te.err = err
+		return sxpf.Nil()
+	}
+	content, isPair := sxpf.GetPair(val)
+	if !isPair {
+		te.err = fmt.Errorf("footnote is not a list: %v", val)
+		return sxpf.Nil()
+	}
+	result := sxpf.MakeList(sxpf.MakeString("("))
+	result.ExtendBang(content).AppendBang(sxpf.MakeString(")"))
+	return te.consAttributes(result, a.AddClass("zs-footnote-inline")).Cons(te.symSpan)
+}
+
+// collectText adds the given string to the text collector, if there is one.
+func (te *TransformEnv) collectText(s string) {
+	if te.textSB != nil {
+		te.textSB.WriteString(s)
+	}
+}
+
 func (te *TransformEnv) transformHTML(args []sxpf.Object) sxpf.Object {
 	if s := te.getString(args[1]); s != "" && IsSafe(s.String()) {
 		return sxpf.Nil().Cons(s).Cons(te.symNoEscape)
@@ -760,7 +1327,7 @@ func (te *TransformEnv) transformHTML(args []sxpf.Object) sxpf.Object {
 	return nil
 }
 
-func (te *TransformEnv) transformBLOB(description *sxpf.Pair, syntax, data sxpf.String) sxpf.Object {
+func (te *TransformEnv) transformBLOB(a attrs.Attributes, description *sxpf.Pair, syntax, data sxpf.String) sxpf.Object {
 	if data == "" {
 		return sxpf.Nil()
 	}
@@ -768,16 +1335,24 @@ func (te *TransformEnv) transformBLOB(description *sxpf.Pair, syntax, data sxpf.
 	case "":
 		return sxpf.Nil()
 	case api.ValueSyntaxSVG:
-		return sxpf.Nil().Cons(sxpf.Nil().Cons(data).Cons(te.symNoEscape)).Cons(te.symP)
-	default:
-		imgAttr := sxpf.Nil().Cons(sxpf.Cons(te.Make("src"), sxpf.MakeString("data:image/"+syntax.String()+";base64,"+data.String())))
-		var sb strings.Builder
-		te.flattenText(&sb, description)
-		if d := sb.String(); d != "" {
-			imgAttr = imgAttr.Cons(sxpf.Cons(te.Make("alt"), sxpf.MakeString(d)))
+		if IsSafeSVG(data.String()) {
+			svg := sxpf.MakeList(te.symNoEscape, data)
+			if description == nil {
+				return sxpf.MakeList(te.symP, svg)
+			}
+			return sxpf.MakeList(te.Make("figure"), svg, description.Cons(te.Make("figcaption")))
 		}
-		return sxpf.Nil().Cons(sxpf.Nil().Cons(imgAttr.Cons(te.symAttr)).Cons(te.Make("img"))).Cons(te.symP)
+		// An SVG image referenced by an img element cannot execute scripts.
+		a = a.Set("src", "data:image/svg+xml;base64,"+base64.StdEncoding.EncodeToString([]byte(data.String())))
+	default:
+		a = a.Set("src", "data:image/"+syntax.String()+";base64,"+data.String())
+	}
+	var sb strings.Builder
+	te.flattenText(&sb, description)
+	if d := sb.String(); d != "" {
+		a = a.Set("alt", d)
 	}
+	return sxpf.Nil().Cons(sxpf.Nil().Cons(te.transformAttribute(a)).Cons(te.Make("img"))).Cons(te.symP)
 }
 
 func (te *TransformEnv) flattenText(sb *strings.Builder, lst *sxpf.Pair) {
@@ -786,6 +1361,14 @@ func (te *TransformEnv) flattenText(sb *strings.Builder, lst *sxpf.Pair) {
 		case sxpf.String:
 			sb.WriteString(obj.String())
 		case *sxpf.Pair:
+			if obj.Car().IsEqual(te.symNoEscape) {
+				// Already escaped content, e.g. from entities. Attribute values must
+				// contain the plain text, because they are escaped later.
+				var inner strings.Builder
+				te.flattenText(&inner, obj.Tail())
+				sb.WriteString(html.UnescapeString(inner.String()))
+				continue
+			}
 			te.flattenText(sb, obj)
 		}
 	}
@@ -798,6 +1381,9 @@ func (te *TransformEnv) bind(name string, minArity int, fn transformFn) {
 		if nArgs := len(args); nArgs < minArity {
 			return sxpf.Nil(), fmt.Errorf("not enough arguments (%d) for form %v (%d)", nArgs, name, minArity)
 		}
+		if te.counts != nil {
+			te.counts[name]++
+		}
 		res := fn(args)
 		return res, te.err
 	}))
@@ -863,6 +1449,15 @@ func (te *TransformEnv) getAttributes(args sxpf.Object) attrs.Attributes {
 	return sz.GetAttributes(te.getList(args))
 }
 
+// refZid returns the zettel identifier of a reference to a zettel, without a
+// fragment or a query.
+func refZid(ref string) api.ZettelID {
+	if pos := strings.IndexAny(ref, "#?"); pos >= 0 {
+		ref = ref[:pos]
+	}
+	return api.ZettelID(ref)
+}
+
 func (te *TransformEnv) transformLink(a attrs.Attributes, refValue sxpf.String, inline []sxpf.Object) sxpf.Object {
 	result := sxpf.MakeList(inline...)
 	if len(inline) == 0 {
@@ -875,7 +1470,17 @@ func (te *TransformEnv) transformLink(a attrs.Attributes, refValue sxpf.String,
 }
 
 func (te *TransformEnv) transformAttribute(a attrs.Attributes) *sxpf.Pair {
-	return te.tr.TransformAttrbute(a)
+	return te.tr.TransformAttribute(a)
+}
+
+// consAttributes prepends the HTML attribute list of the given attributes to
+// the list. Nothing is prepended, if no attribute remains, e.g. if only the
+// default attribute was given.
+func (te *TransformEnv) consAttributes(lst *sxpf.Pair, a attrs.Attributes) *sxpf.Pair {
+	if al := te.transformAttribute(a); al != nil {
+		return lst.Cons(al)
+	}
+	return lst
 }
 
 func (te *TransformEnv) transformMeta(a attrs.Attributes) *sxpf.Pair {
@@ -897,3 +1502,24 @@ func IsSafe(s string) bool {
 	}
 	return true
 }
+
+var (
+	unsafeSVGSnippets = []string{"<foreignobject", "javascript:"}
+	svgEventAttribute = regexp.MustCompile(`(?i)[\s/]on[a-z]+\s*=`)
+)
+
+// IsSafeSVG returns true if the given SVG data can be embedded into HTML. In
+// addition to IsSafe, it rejects foreignObject elements, javascript URLs, and
+// event handler attributes.
+func IsSafeSVG(s string) bool {
+	if !IsSafe(s) {
+		return false
+	}
+	lower := strings.ToLower(s)
+	for _, snippet := range unsafeSVGSnippets {
+		if strings.Contains(lower, snippet) {
+			return false
+		}
+	}
+	return !svgEventAttribute.MatchString(s)
+}
@@ -0,0 +1,1001 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package shtml_test
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"zettelstore.de/c/attrs"
+	"zettelstore.de/c/shtml"
+	"zettelstore.de/c/sz"
+	"zettelstore.de/c/text"
+	"zettelstore.de/sx.fossil/sxpf"
+	"zettelstore.de/sx.fossil/sxpf/eval"
+	"zettelstore.de/sx.fossil/sxpf/reader"
+)
+
+// withQuoteStyle is true iff all transformers of the tests have a quote style,
+// see TestMain.
+var withQuoteStyle bool
+
+// TestMain runs all tests a second time, with a quote style for a language
+// that is not used by the tests. If at least one quote style is set, an AST is
+// evaluated differently to track the nesting of quotes. This must not change
+// any result.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		withQuoteStyle = true
+		code = m.Run()
+	}
+	os.Exit(code)
+}
+
+// newTransformer creates a new transformer for a test.
+func newTransformer(headingOffset int, sf sxpf.SymbolFactory) *shtml.Transformer {
+	tr := shtml.NewTransformer(headingOffset, sf)
+	if withQuoteStyle {
+		tr.SetQuoteStyle("x-test", [2]string{"<", ">"}, [2]string{"(", ")"})
+	}
+	return tr
+}
+
+// readAST reads the given s-expression as a zettel AST.
+func readAST(t testing.TB, src string) *sxpf.Pair {
+	t.Helper()
+	obj, err := reader.MakeReader(strings.NewReader(src)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lst, isPair := sxpf.GetPair(obj)
+	if !isPair {
+		t.Fatalf("not a list: %v", obj)
+	}
+	return lst
+}
+
+// transform reads the AST and returns the result of its transformation as a string.
+func transform(t *testing.T, tr *shtml.Transformer, src string) string {
+	t.Helper()
+	res, err := tr.Transform(readAST(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return toString(res)
+}
+
+// toString produces a stable textual representation of a SHTML object.
+func toString(obj sxpf.Object) string {
+	var sb strings.Builder
+	writeObject(&sb, obj)
+	return sb.String()
+}
+
+func writeObject(sb *strings.Builder, obj sxpf.Object) {
+	if sxpf.IsNil(obj) {
+		sb.WriteString("()")
+		return
+	}
+	if s, isString := sxpf.GetString(obj); isString {
+		sb.WriteByte('"')
+		sb.WriteString(s.String())
+		sb.WriteByte('"')
+		return
+	}
+	if sym, isSymbol := sxpf.GetSymbol(obj); isSymbol {
+		sb.WriteString(sym.Name())
+		return
+	}
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair {
+		sb.WriteString(obj.String())
+		return
+	}
+	sb.WriteByte('(')
+	for node := pair; ; {
+		writeObject(sb, node.Car())
+		next, isNextPair := sxpf.GetPair(node.Cdr())
+		if !isNextPair {
+			sb.WriteString(" . ")
+			writeObject(sb, node.Cdr())
+			break
+		}
+		if next == nil {
+			break
+		}
+		sb.WriteByte(' ')
+		node = next
+	}
+	sb.WriteByte(')')
+}
+
+func TestEntities(t *testing.T) {
+	testcases := []struct {
+		src   string
+		plain string
+		ent   string
+	}{
+		{`(INLINE (TEXT "abc"))`, `("abc")`, `("abc")`},
+		{"(INLINE (TEXT \"a\u00adb\"))", "(\"a\u00adb\")", `((@H "a&shy;b"))`},
+		{"(INLINE (TEXT \"<1\u00a0&\u00a02>\"))", "(\"<1\u00a0&\u00a02>\")", `((@H "&lt;1&nbsp;&amp;&nbsp;2&gt;"))`},
+		{"(INLINE (TEXT \"\u00ad\"))", "(\"\u00ad\")", `((@H "&shy;"))`},
+	}
+	for i, tc := range testcases {
+		tr := newTransformer(1, nil)
+		if got := transform(t, tr, tc.src); got != tc.plain {
+			t.Errorf("%d: %q without entities: expected %s, but got %s", i, tc.src, tc.plain, got)
+		}
+		tr.SetEntities(true)
+		if got := transform(t, tr, tc.src); got != tc.ent {
+			t.Errorf("%d: %q with entities: expected %s, but got %s", i, tc.src, tc.ent, got)
+		}
+	}
+}
+
+func TestEntitiesInAttribute(t *testing.T) {
+	tr := newTransformer(1, nil)
+	tr.SetEntities(true)
+	src := "(BLOCK (BLOB (INLINE (TEXT \"a\u00adb<\")) \"png\" \"AAAA\"))"
+	exp := "((p (img (@ (alt . \"a\u00adb<\") (src . \"data:image/png;base64,AAAA\")))))"
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	const good = `<svg><circle r=\"1\"/></svg>`
+	bad := []string{
+		`<svg><script>alert(1)</script></svg>`,
+		`<svg><foreignObject><p>x</p></foreignObject></svg>`,
+		`<svg onload=\"alert(1)\"/>`,
+		`<svg><a href=\"javascript:alert(1)\">x</a></svg>`,
+	}
+	tr := newTransformer(1, nil)
+	exp := `((p (@H "<svg><circle r="1"/></svg>")))`
+	if got := transform(t, tr, `(BLOCK (BLOB () "svg" "`+good+`"))`); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+	exp = `((figure (@H "<svg><circle r="1"/></svg>") (figcaption "A" " " (em "B"))))`
+	if got := transform(t, tr, `(BLOCK (BLOB (INLINE (TEXT "A") (SPACE) (FORMAT-EMPH () (TEXT "B"))) "svg" "`+good+`"))`); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+	exp = `((figure (@H "<svg><circle r="1"/></svg>") (figcaption "S")))`
+	if got := transform(t, tr, `(INLINE (EMBED-BLOB (quote (("summary" . "S"))) "svg" "`+good+`"))`); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+	for _, svg := range bad {
+		got := transform(t, tr, `(BLOCK (BLOB (INLINE (TEXT "D")) "svg" "`+svg+`"))`)
+		if !strings.HasPrefix(got, `((p (img (@ (alt . "D") (src . "data:image/svg+xml;base64,`) {
+			t.Errorf("%s: expected img fallback, but got %s", svg, got)
+		}
+	}
+}
+
+func TestCiteHandler(t *testing.T) {
+	src := `(INLINE (CITE () "b" (TEXT "x")) (CITE () "a") (CITE () "b"))`
+	tr := newTransformer(1, nil)
+	exp := `((span "b" ", " "x") (span "a") (span "b"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("default: expected %s, but got %s", exp, got)
+	}
+	if got := strings.Join(tr.CitedKeys(), ","); got != "b,a" {
+		t.Errorf("expected cited keys b,a, but got %q", got)
+	}
+	tr.Endnotes()
+	if keys := tr.CitedKeys(); len(keys) != 0 {
+		t.Errorf("cited keys not cleared: %v", keys)
+	}
+
+	tr.SetCiteHandler(func(key string, _ attrs.Attributes, inline *sxpf.Pair) *sxpf.Pair {
+		if key == "a" {
+			return nil
+		}
+		num := ""
+		for i, k := range tr.CitedKeys() {
+			if k == key {
+				num = strconv.Itoa(i + 1)
+			}
+		}
+		return inline.Cons(sxpf.MakeString("[" + num + "]")).Cons(tr.Make("cite"))
+	})
+	exp = `((cite "[1]" "x") (span "a") (cite "[1]"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("handler: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	const a = `(quote (("-" . "") ("title" . "T")))`
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{`(BLOCK (THEMATIC ` + a + `))`, `((hr (@ (title . "T"))))`},
+		{`(BLOCK (THEMATIC (quote (("-" . "")))))`, `((hr))`},
+		{`(BLOCK (THEMATIC))`, `((hr))`},
+		{`(INLINE (HARD ` + a + `))`, `((br (@ (title . "T"))))`},
+		{`(INLINE (HARD))`, `((br))`},
+		{`(BLOCK (HEADING 1 ` + a + ` "" "" (INLINE (TEXT "h"))))`, `((h2 (@ (title . "T")) "h"))`},
+		{`(BLOCK (REGION-BLOCK ` + a + ` () ))`, `((div (@ (title . "T"))))`},
+		{`(INLINE (FORMAT-EMPH ` + a + ` (TEXT "e")))`, `((em (@ (title . "T")) "e"))`},
+		{`(INLINE (FORMAT-EMPH (quote (("-" . ""))) (TEXT "e")))`, `((em "e"))`},
+		{`(INLINE (LITERAL-CODE ` + a + ` "c"))`, `((code (@ (title . "T")) "c"))`},
+		{`(INLINE (CITE ` + a + ` "k"))`, `((span (@ (title . "T")) "k"))`},
+		{`(INLINE (LINK-INVALID ` + a + ` "r" (TEXT "l")))`, `((span (@ (title . "T")) "l"))`},
+		{`(INLINE (EMBED-BLOB ` + a + ` "png" "AAAA"))`, `((p (img (@ (src . "data:image/png;base64,AAAA") (title . "T")))))`},
+		{`(INLINE (EMBED ` + a + ` (quote (ZETTEL "12345678901234")) "svg"))`, `((figure (embed (@ (src . "/12345678901234.svg") (title . "T") (type . "image/svg+xml")))))`},
+	}
+	for i, tc := range testcases {
+		tr := newTransformer(1, nil)
+		if got := transform(t, tr, tc.src); got != tc.exp {
+			t.Errorf("%d: %s: expected %s, but got %s", i, tc.src, tc.exp, got)
+		}
+	}
+}
+
+func TestEndnoteSettings(t *testing.T) {
+	src := `(INLINE (TEXT "a") (ENDNOTE () (quote (INLINE (TEXT "n")))))`
+	tr := newTransformer(1, nil)
+	tr.SetUnique("u-")
+	exp := `("a" (sup (@ (id . "fnref:u-1")) (a (@ (class . "zs-noteref") (href . "#fn:u-1") (role . "doc-noteref")) "1")))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("links: expected %s, but got %s", exp, got)
+	}
+	tr.SetUnique("v-")
+	tr.SetNoLinks(true)
+	exp = `(ol (@ (class . "zs-endnotes")) (li (@ (class . "zs-endnote") (id . "fn:u-1") (role . "doc-endnote") (value . "1")) "n" " " (a (@ (class . "zs-endnote-backref") (href . "#fnref:u-1") (role . "doc-backlink")) "↩︎")))`
+	if got := toString(tr.Endnotes()); got != exp {
+		t.Errorf("endnotes with links: expected %s, but got %s", exp, got)
+	}
+
+	exp = `("a" (sup (@ (id . "fnref:v-1")) "1"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("no links: expected %s, but got %s", exp, got)
+	}
+	tr.SetUnique("w-")
+	tr.SetNoLinks(false)
+	exp = `(ol (@ (class . "zs-endnotes")) (li (@ (class . "zs-endnote") (id . "fn:v-1") (role . "doc-endnote") (value . "1")) "n"))`
+	if got := toString(tr.Endnotes()); got != exp {
+		t.Errorf("endnotes without links: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestFootnoteMode(t *testing.T) {
+	src := `(INLINE (TEXT "a") (ENDNOTE (quote (("k" . "v"))) (quote (INLINE (TEXT "n") (FORMAT-EMPH () (TEXT "e"))))))`
+	testcases := []struct {
+		mode     shtml.FootnoteMode
+		exp      string
+		endnotes bool
+	}{
+		{shtml.FootnotesEndnote, `("a" (sup (@ (id . "fnref:1")) (a (@ (class . "zs-noteref") (href . "#fn:1") (role . "doc-noteref")) "1")))`, true},
+		{shtml.FootnotesInline, `("a" (span (@ (class . "zs-footnote-inline") (k . "v")) "(" "n" (em "e") ")"))`, false},
+		{shtml.FootnotesIgnore, `("a" ())`, false},
+	}
+	for _, tc := range testcases {
+		tr := newTransformer(1, nil)
+		tr.SetFootnoteMode(tc.mode)
+		if got := transform(t, tr, src); got != tc.exp {
+			t.Errorf("mode %d: expected %s, but got %s", tc.mode, tc.exp, got)
+		}
+		if got := tr.Endnotes(); (got != nil) != tc.endnotes {
+			t.Errorf("mode %d: unexpected endnotes %s", tc.mode, toString(got))
+		}
+	}
+
+	tr := newTransformer(1, nil)
+	tr.SetFootnoteMode(shtml.FootnotesInline)
+	src = `(INLINE (ENDNOTE () (quote (INLINE (TEXT "x") (ENDNOTE () (quote (INLINE (TEXT "y"))))))))`
+	exp := `((span (@ (class . "zs-footnote-inline")) "(" "x" (span (@ (class . "zs-footnote-inline")) "(" "y" ")") ")"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("nested: expected %s, but got %s", exp, got)
+	}
+
+	tr.SetRebinder(func(te *shtml.TransformEnv) {
+		te.Rebind(sz.NameSymInline, func([]sxpf.Object, eval.Callable) sxpf.Object { return sxpf.MakeString("x") })
+	})
+	ast := readAST(t, `(BLOCK (PARA (ENDNOTE () (quote (INLINE (TEXT "n"))))))`)
+	if _, err := tr.Transform(ast); err == nil || !strings.Contains(err.Error(), "footnote is not a list") {
+		t.Errorf("expected error for footnote that is not a list, but got %v", err)
+	}
+}
+
+func TestRubyAttribute(t *testing.T) {
+	src := `(INLINE (FORMAT-SPAN (quote (("ruby" . "とうきょう") ("lang" . "ja"))) (TEXT "東") (FORMAT-STRONG () (TEXT "京"))))`
+	tr := newTransformer(1, nil)
+	exp := `((span (@ (lang . "ja") (ruby . "とうきょう")) "東" (strong "京")))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("disabled: expected %s, but got %s", exp, got)
+	}
+	tr.SetRubyAttribute("ruby")
+	exp = `((ruby (@ (lang . "ja")) "東" (strong "京") (rt "とうきょう")))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("enabled: expected %s, but got %s", exp, got)
+	}
+	src = `(INLINE (FORMAT-SPAN () (FORMAT-SPAN (quote (("ruby" . "a"))) (TEXT "x"))))`
+	exp = `((span (ruby "x" (rt "a"))))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("nested: expected %s, but got %s", exp, got)
+	}
+	tr.SetRubyAttribute("")
+	exp = `((span (span (@ (ruby . "a")) "x")))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("disabled again: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestRebinder(t *testing.T) {
+	src := `(INLINE (TEXT "a") (SPACE) (TEXT "b"))`
+	tr := newTransformer(1, nil)
+	if got, exp := transform(t, tr, src), `("a" " " "b")`; got != exp {
+		t.Errorf("before: expected %s, but got %s", exp, got)
+	}
+	calls := 0
+	tr.SetRebinder(func(te *shtml.TransformEnv) {
+		calls++
+		te.Rebind(sz.NameSymText, func(args []sxpf.Object, _ eval.Callable) sxpf.Object {
+			return sxpf.MakeString(strings.ToUpper(args[0].String()))
+		})
+	})
+	for i := 0; i < 2; i++ {
+		if got, exp := transform(t, tr, src), `("A" " " "B")`; got != exp {
+			t.Errorf("rebound %d: expected %s, but got %s", i, exp, got)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected rebinder to be called twice, but got %d", calls)
+	}
+	tr.SetRebinder(nil)
+	if got, exp := transform(t, tr, src), `("a" " " "b")`; got != exp {
+		t.Errorf("after: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestSymbolFactories(t *testing.T) {
+	src := `(INLINE (TEXT "a"))`
+	tr := newTransformer(1, nil)
+	if tr.ASTSymbolFactory() == tr.SymbolFactory() {
+		t.Error("AST and HTML symbol factories must be different")
+	}
+
+	obj, err := reader.MakeReader(strings.NewReader(src), tr.ReaderOptions()...).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.Transform(obj.(*sxpf.Pair))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := res.String(), `("a")`; got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+
+	obj, err = reader.MakeReader(strings.NewReader(src), reader.WithSymbolFactory(tr.SymbolFactory())).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tr.Transform(obj.(*sxpf.Pair)); !errors.Is(err, shtml.ErrInvalidSymbolFactory) {
+		t.Errorf("expected error %v, but got %v", shtml.ErrInvalidSymbolFactory, err)
+	}
+}
+
+func TestLinkDataAttributes(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{`(INLINE (LINK-ZETTEL () "12345678901234" (TEXT "z")))`,
+			`((a (@ (data-zid . "12345678901234") (href . "12345678901234")) "z"))`},
+		{`(INLINE (LINK-FOUND () "12345678901234#sec"))`,
+			`((a (@ (data-zid . "12345678901234") (href . "12345678901234#sec")) "12345678901234#sec"))`},
+		{`(INLINE (LINK-SELF () "12345678901234?q=1"))`,
+			`((a (@ (data-zid . "12345678901234") (href . "12345678901234?q=1")) "12345678901234?q=1"))`},
+		{`(INLINE (LINK-SELF () "#sec"))`, `((a (@ (href . "#sec")) "#sec"))`},
+		{`(INLINE (LINK-ZETTEL () "1234567890123x"))`, `((a (@ (href . "1234567890123x")) "1234567890123x"))`},
+		{`(INLINE (LINK-EXTERNAL () "https://zettelstore.de"))`,
+			`((a (@ (class . "external") (data-external . "true") (href . "https://zettelstore.de")) "https://zettelstore.de"))`},
+		{`(INLINE (LINK-HOSTED () "/12345678901234"))`, `((a (@ (href . "/12345678901234")) "/12345678901234"))`},
+	}
+	tr := newTransformer(1, nil)
+	tr.SetLinkDataAttributes(true)
+	for i, tc := range testcases {
+		if got := transform(t, tr, tc.src); got != tc.exp {
+			t.Errorf("%d: expected %s, but got %s", i, tc.exp, got)
+		}
+	}
+	tr.SetLinkDataAttributes(false)
+	exp := `((a (@ (href . "12345678901234")) "z"))`
+	if got := transform(t, tr, testcases[0].src); got != exp {
+		t.Errorf("disabled: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestQueryLinkBase(t *testing.T) {
+	src := `(INLINE (LINK-QUERY () "tags:#a & b" (TEXT "q")))`
+	testcases := []struct {
+		base string
+		exp  string
+	}{
+		{"", "?q=tags%3A%23a+%26+b"},
+		{"/search/", "/search/?q=tags%3A%23a+%26+b"},
+		{"/search?lang=en", "/search?lang=en&q=tags%3A%23a+%26+b"},
+		{"/search?", "/search?q=tags%3A%23a+%26+b"},
+	}
+	tr := newTransformer(1, nil)
+	for _, tc := range testcases {
+		tr.SetQueryLinkBase(tc.base)
+		exp := `((a (@ (href . "` + tc.exp + `")) "q"))`
+		if got := transform(t, tr, src); got != exp {
+			t.Errorf("base %q: expected %s, but got %s", tc.base, exp, got)
+		}
+	}
+}
+
+func TestHeadingNumbering(t *testing.T) {
+	src := `(BLOCK
+  (HEADING 1 () "" "a" (INLINE (TEXT "A")))
+  (HEADING 2 () "" "a1" (INLINE (TEXT "A1")))
+  (HEADING 2 () "" "" (INLINE (TEXT "A2")))
+  (HEADING 4 () "" "a2x1" (INLINE (TEXT "A2x1")))
+  (HEADING 2 () "" "a3" (INLINE (TEXT "A3")))
+  (HEADING 1 () "" "b" (INLINE (TEXT "B")))
+  (HEADING 3 () "" "b01" (INLINE (TEXT "B01"))))`
+	tr := newTransformer(1, nil)
+	tr.SetHeadingNumbering(true)
+	num := func(n string) string { return `(span (@ (class . "zs-heading-number")) "` + n + `") " "` }
+	exp := `(` +
+		`(h2 (@ (id . "a")) ` + num("1") + ` "A") ` +
+		`(h3 (@ (id . "a1")) ` + num("1.1") + ` "A1") ` +
+		`(h3 ` + num("1.2") + ` "A2") ` +
+		`(h5 (@ (id . "a2x1")) ` + num("1.2.0.1") + ` "A2x1") ` +
+		`(h3 (@ (id . "a3")) ` + num("1.3") + ` "A3") ` +
+		`(h2 (@ (id . "b")) ` + num("2") + ` "B") ` +
+		`(h4 (@ (id . "b01")) ` + num("2.0.1") + ` "B01"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("expected\n%s\nbut got\n%s", exp, got)
+	}
+	expNums := map[string]string{"a": "1", "a1": "1.1", "a2x1": "1.2.0.1", "a3": "1.3", "b": "2", "b01": "2.0.1"}
+	gotNums := tr.HeadingNumbers()
+	if len(gotNums) != len(expNums) {
+		t.Errorf("expected numbers %v, but got %v", expNums, gotNums)
+	}
+	for frag, n := range expNums {
+		if got := gotNums[frag]; got != n {
+			t.Errorf("fragment %q: expected %q, but got %q", frag, n, got)
+		}
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	src := `(BLOCK
+  (HEADING 1 () "" "" (INLINE (TEXT "日本語")))
+  (HEADING 1 () "" "" (INLINE (TEXT "日本語")))
+  (HEADING 1 () "a" "a" (INLINE (TEXT "A")))
+  (HEADING 1 () "" "" (INLINE (TEXT "A"))))`
+	tr := newTransformer(1, nil)
+	if got, exp := transform(t, tr, src), `((h2 "日本語") (h2 "日本語") (h2 (@ (id . "a")) "A") (h2 "A"))`; got != exp {
+		t.Errorf("disabled: expected\n%s\nbut got\n%s", exp, got)
+	}
+	tr.SetHeadingAnchors(true)
+	jp := text.AnchorFor("日本語")
+	exp := `((h2 (@ (id . "` + jp + `")) "日本語") (h2 (@ (id . "` + jp + `-2")) "日本語") ` +
+		`(h2 (@ (id . "a")) "A") (h2 (@ (id . "a-2")) "A"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("enabled: expected\n%s\nbut got\n%s", exp, got)
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	src := `(BLOCK (PARA (TEXT "a") (SPACE) (TEXT "b")) (PARA (TEXT "c")))`
+	tr := newTransformer(1, nil)
+	var stats shtml.TransformStats
+	tr.SetStatsCollector(&stats)
+	transform(t, tr, src)
+	transform(t, tr, src)
+	for name, exp := range map[string]int{"BLOCK": 2, "PARA": 4, "TEXT": 6, "SPACE": 2, "HEADING": 0} {
+		if got := stats.Count(name); got != exp {
+			t.Errorf("%s: expected %d, but got %d", name, exp, got)
+		}
+	}
+	if stats.Duration() <= 0 {
+		t.Error("no duration collected")
+	}
+	top := stats.TopTypes(3)
+	exp := []shtml.TypeCount{{"TEXT", 6}, {"PARA", 4}, {"BLOCK", 2}}
+	if len(top) != len(exp) {
+		t.Fatalf("expected %v, but got %v", exp, top)
+	}
+	for i := range exp {
+		if top[i] != exp[i] {
+			t.Errorf("%d: expected %v, but got %v", i, exp[i], top[i])
+		}
+	}
+
+	tr.SetStatsCollector(nil)
+	transform(t, tr, src)
+	if got := stats.Count("TEXT"); got != 6 {
+		t.Errorf("no statistics expected, but got %d", got)
+	}
+}
+
+func TestMarkAsHighlight(t *testing.T) {
+	withFrag := `(INLINE (MARK "m" "m" "frag" (TEXT "a")))`
+	noFrag := `(INLINE (MARK "" "" "" (TEXT "a")))`
+	testcases := []struct {
+		highlight bool
+		noLinks   bool
+		src       string
+		exp       string
+	}{
+		{false, false, withFrag, `((a (@ (id . "frag")) "a"))`},
+		{false, false, noFrag, `((span "a"))`},
+		{false, true, withFrag, `((span "a"))`},
+		{true, false, withFrag, `((mark (@ (class . "zs-mark") (id . "frag")) "a"))`},
+		{true, false, noFrag, `((mark (@ (class . "zs-mark")) "a"))`},
+		{true, true, withFrag, `((mark (@ (class . "zs-mark")) "a"))`},
+	}
+	for i, tc := range testcases {
+		tr := newTransformer(1, nil)
+		tr.SetMarkAsHighlight(tc.highlight)
+		tr.SetNoLinks(tc.noLinks)
+		if got := transform(t, tr, tc.src); got != tc.exp {
+			t.Errorf("%d: expected %s, but got %s", i, tc.exp, got)
+		}
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	// Marks, headings, and endnotes place the unique prefix before the fragment.
+	src := `(BLOCK (HEADING 1 () "" "h" (INLINE (TEXT "H"))) (PARA (MARK "m" "m" "frag" (TEXT "a")) (ENDNOTE () (quote (INLINE (TEXT "n"))))))`
+	tr := newTransformer(1, nil)
+	tr.SetUnique("u-")
+	exp := `((h2 (@ (id . "u-h")) "H") (p (a (@ (id . "u-frag")) "a") (sup (@ (id . "fnref:u-1")) (a (@ (class . "zs-noteref") (href . "#fn:u-1") (role . "doc-noteref")) "1"))))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	src := `(BLOCK
+  (HEADING 1 () "" "" (INLINE (TEXT "H")))
+  (VERBATIM-COMMENT (quote (("-" . ""))) "block")
+  (VERBATIM-COMMENT () "hidden")
+  (PARA (TEXT "a") (LITERAL-COMMENT (quote (("-" . ""))) "inline") (TEXT "b")))`
+	testcases := []struct {
+		keep bool
+		exp  string
+	}{
+		{true, `((h2 "H") (@@@ "block") () (p "a" (@@ "inline") "b"))`},
+		{false, `((h2 "H") () () (p "a" () "b"))`},
+	}
+	for _, tc := range testcases {
+		tr := newTransformer(1, nil)
+		tr.SetKeepComments(tc.keep)
+		if got := transform(t, tr, src); got != tc.exp {
+			t.Errorf("keep=%v: expected %s, but got %s", tc.keep, tc.exp, got)
+		}
+	}
+}
+
+func TestAttributeOrder(t *testing.T) {
+	src := `(INLINE
+  (LINK-EXTERNAL (quote (("title" . "T") ("target" . "_blank") ("rel" . "noopener") ("class" . "a"))) "https://zettelstore.de" (TEXT "z"))
+  (ENDNOTE (quote (("title" . "N") ("class" . "b") ("role" . "x"))) (quote (INLINE (TEXT "n")))))`
+	tr := newTransformer(1, nil)
+	var first string
+	for i := 0; i < 100; i++ {
+		res, err := tr.Transform(readAST(t, src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := toString(res) + toString(tr.Endnotes())
+		if i == 0 {
+			first = got
+			continue
+		}
+		if got != first {
+			t.Fatalf("%d: output differs:\n%s\n%s", i, first, got)
+		}
+	}
+	exp := `((a (@ (class . "a external") (href . "https://zettelstore.de") (rel . "noopener") (target . "_blank") (title . "T")) "z") ` +
+		`(sup (@ (id . "fnref:1")) (a (@ (class . "zs-noteref") (href . "#fn:1") (role . "doc-noteref")) "1")))` +
+		`(ol (@ (class . "zs-endnotes")) (li (@ (class . "b zs-endnote") (id . "fn:1") (role . "doc-endnote") (title . "N") (value . "1")) "n" " " ` +
+		`(a (@ (class . "zs-endnote-backref") (href . "#fnref:1") (role . "doc-backlink")) "↩︎")))`
+	if first != exp {
+		t.Errorf("expected\n%s\nbut got\n%s", exp, first)
+	}
+}
+
+func TestConcurrentTransform(t *testing.T) {
+	tr := newTransformer(1, nil)
+	const n = 8
+	asts := make([]*sxpf.Pair, n)
+	for i := range asts {
+		num := strconv.Itoa(i)
+		asts[i] = readAST(t, `(INLINE (TEXT "t`+num+`") (ENDNOTE () (quote (INLINE (TEXT "n`+num+`")))) (CITE () "k`+num+`"))`)
+	}
+	results := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range asts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var notes shtml.Notes
+			res, err := tr.TransformNotes(asts[i], &notes)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = toString(res) + toString(sxpf.MakeList(sxpf.MakeString(strings.Join(notes.CitedKeys(), " ")))) + toString(tr.EndnotesOf(&notes))
+		}(i)
+	}
+	wg.Wait()
+	for i, got := range results {
+		if errs[i] != nil {
+			t.Errorf("%d: %v", i, errs[i])
+			continue
+		}
+		num := strconv.Itoa(i)
+		exp := `("t` + num + `" (sup (@ (id . "fnref:1")) (a (@ (class . "zs-noteref") (href . "#fn:1") (role . "doc-noteref")) "1")) (span "k` + num + `"))` +
+			`("k` + num + `")` +
+			`(ol (@ (class . "zs-endnotes")) (li (@ (class . "zs-endnote") (id . "fn:1") (role . "doc-endnote") (value . "1")) "n` + num + `" " " (a (@ (class . "zs-endnote-backref") (href . "#fnref:1") (role . "doc-backlink")) "↩︎")))`
+		if got != exp {
+			t.Errorf("%d: expected %s, but got %s", i, exp, got)
+		}
+	}
+}
+
+func TestSanitizePolicy(t *testing.T) {
+	src := `(INLINE (LINK-EXTERNAL (quote (("onclick" . "alert(1)") ("title" . "T"))) "javascript:alert(1)" (TEXT "x")))`
+	tr := newTransformer(1, nil)
+	exp := `((a (@ (class . "external") (href . "javascript:alert(1)") (onclick . "alert(1)") (title . "T")) "x"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("without policy: expected %s, but got %s", exp, got)
+	}
+	tr.SetSanitizePolicy(attrs.DefaultSanitizePolicy)
+	exp = `((a (@ (class . "external") (title . "T")) "x"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("with policy: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestTransformAttribute(t *testing.T) {
+	a := attrs.Attributes{"-": "", "alt": "", "id": "x"}
+	tr := newTransformer(1, nil)
+	exp := `(@ (alt . "") (id . "x"))`
+	if got := toString(tr.TransformAttribute(a)); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+	if got, exp := toString(tr.TransformAttrbute(a)), toString(tr.TransformAttribute(a)); got != exp {
+		t.Errorf("deprecated method: expected %s, but got %s", exp, got)
+	}
+	tr.SetDropEmpty(true)
+	exp = `(@ (id . "x"))`
+	if got := toString(tr.TransformAttribute(a)); got != exp {
+		t.Errorf("drop empty: expected %s, but got %s", exp, got)
+	}
+	if got := tr.TransformAttribute(attrs.Attributes{"alt": ""}); got != nil {
+		t.Errorf("drop empty: expected nil, but got %s", toString(got))
+	}
+}
+
+func TestQuoteStyle(t *testing.T) {
+	const src = `(INLINE (TEXT "a") (SPACE) (FORMAT-QUOTE () (TEXT "b") (SPACE) (FORMAT-QUOTE () (TEXT "c") (SPACE) (FORMAT-QUOTE () (TEXT "d")))))`
+	tr := newTransformer(1, nil)
+	exp := `("a" " " (q "b" " " (q "c" " " (q "d"))))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("no style: expected %s, but got %s", exp, got)
+	}
+
+	tr.SetQuoteStyle("", [2]string{"“", "”"}, [2]string{"‘", "’"})
+	tr.SetQuoteStyle("de", [2]string{"„", "“"}, [2]string{"‚", "‘"})
+	tr.SetQuoteStyle("fr", [2]string{"« ", " »"}, [2]string{"“", "”"})
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{src, `("a" " " (span "“" "b" " " (span "‘" "c" " " (span "“" "d" "”") "’") "”"))`},
+		{
+			`(INLINE (FORMAT-QUOTE (quote (("lang" . "de"))) (TEXT "b") (FORMAT-QUOTE () (TEXT "c"))))`,
+			`((span (@ (lang . "de")) "„" "b" (span "‚" "c" "‘") "“"))`,
+		},
+		{
+			`(INLINE (FORMAT-QUOTE (quote (("lang" . "de-CH") ("" . "x"))) (TEXT "b")))`,
+			`((span (@ (lang . "de-CH") (class . "x")) "„" "b" "“"))`,
+		},
+		{
+			"(INLINE (FORMAT-QUOTE (quote ((\"lang\" . \"fr\"))) (TEXT \"b\") (FORMAT-QUOTE () (TEXT \"c\"))))",
+			"((span (@ (lang . \"fr\")) \"« \" \"b\" (span \"“\" \"c\" \"”\") \" »\"))",
+		},
+		{
+			`(INLINE (FORMAT-QUOTE () (TEXT "b") (FORMAT-QUOTE (quote (("lang" . "de"))) (TEXT "c"))))`,
+			`((span "“" "b" (span (@ (lang . "de")) "‚" "c" "‘") "”"))`,
+		},
+		{
+			`(BLOCK (PARA (FORMAT-QUOTE () (TEXT "p"))))`,
+			`((p (span "“" "p" "”")))`,
+		},
+		{
+			`(INLINE (FORMAT-SPAN (quote (("lang" . "fr"))) (FORMAT-QUOTE () (TEXT "b"))) (FORMAT-QUOTE () (TEXT "c")))`,
+			"((span (@ (lang . \"fr\")) (span \"« \" \"b\" \" »\")) (span \"“\" \"c\" \"”\"))",
+		},
+		{
+			`(BLOCK (REGION-QUOTE (quote (("lang" . "de-CH"))) (BLOCK (PARA (FORMAT-QUOTE () (TEXT "b"))))))`,
+			`((blockquote (@ (lang . "de-CH")) (p (span "„" "b" "“"))))`,
+		},
+		{
+			`(INLINE (FORMAT-QUOTE (quote (("lang" . "de"))) (FORMAT-SPAN (quote (("lang" . "en"))) (FORMAT-QUOTE () (TEXT "b")))))`,
+			`((span (@ (lang . "de")) "„" (span (@ (lang . "en")) (span "‘" "b" "’")) "“"))`,
+		},
+	}
+	for i, tc := range testcases {
+		if got := transform(t, tr, tc.src); got != tc.exp {
+			t.Errorf("%d: %s: expected %s, but got %s", i, tc.src, tc.exp, got)
+		}
+	}
+
+	exp = `((span "“" "a" (sup (@ (id . "fnref:1")) (a (@ (class . "zs-noteref") (href . "#fn:1") (role . "doc-noteref")) "1")) "”"))`
+	if got := transform(t, tr, `(INLINE (FORMAT-QUOTE () (TEXT "a") (ENDNOTE () (quote (INLINE (FORMAT-QUOTE () (TEXT "n")))))))`); got != exp {
+		t.Errorf("quote with endnote: expected %s, but got %s", exp, got)
+	}
+	if got := toString(tr.Endnotes()); !strings.Contains(got, `(span "‘" "n" "’")`) {
+		t.Errorf("quote within endnote of a quote: expected secondary marks, but got %s", got)
+	}
+
+	tr.SetRebinder(func(te *shtml.TransformEnv) {
+		te.Rebind(sz.NameSymFormatQuote, func(args []sxpf.Object, prevFn eval.Callable) sxpf.Object {
+			obj, err := prevFn.Call(nil, nil, args)
+			if err != nil {
+				return sxpf.Nil()
+			}
+			return sxpf.MakeList(te.Make("i"), obj)
+		})
+	})
+	exp = `((i (span "“" "b" (i (span "‘" "c" "’")) "”")))`
+	if got := transform(t, tr, `(INLINE (FORMAT-QUOTE () (TEXT "b") (FORMAT-QUOTE () (TEXT "c"))))`); got != exp {
+		t.Errorf("rebound quote: expected %s, but got %s", exp, got)
+	}
+
+	tr = newTransformer(1, nil)
+	tr.SetQuoteStyle("de", [2]string{"„", "“"}, [2]string{"‚", "‘"})
+	exp = `("a" " " (q "b" " " (q "c" " " (q "d"))))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("no matching style: expected %s, but got %s", exp, got)
+	}
+	exp = `((span (@ (lang . "en")) (q (@ (class . "x")) "b")))`
+	if got := transform(t, tr, `(INLINE (FORMAT-QUOTE (quote (("lang" . "en") ("" . "x"))) (TEXT "b")))`); got != exp {
+		t.Errorf("no matching style: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestAssetURL(t *testing.T) {
+	const src = `(INLINE (EMBED () (quote (ZETTEL "12345678901234")) "svg"))`
+	testcases := []struct {
+		fn  shtml.AssetURLFunc
+		exp string
+	}{
+		{nil, "/12345678901234.svg"},
+		{func(zid, ext string) string { return "/prefix/" + zid + "." + ext }, "/prefix/12345678901234.svg"},
+		{func(zid, ext string) string { return "assets/" + zid + "." + ext }, "assets/12345678901234.svg"},
+	}
+	for i, tc := range testcases {
+		tr := newTransformer(1, nil)
+		tr.SetAssetURLFunc(tc.fn)
+		exp := `((figure (embed (@ (src . "` + tc.exp + `") (type . "image/svg+xml")))))`
+		if got := transform(t, tr, src); got != exp {
+			t.Errorf("%d: expected %s, but got %s", i, exp, got)
+		}
+	}
+}
+
+func TestAltText(t *testing.T) {
+	provider := func(ref string) string {
+		if ref == "12345678901234" {
+			return "Title"
+		}
+		return ""
+	}
+	testcases := []struct {
+		fn  shtml.AltTextFunc
+		src string
+		exp string
+	}{
+		{nil, `(EMBED () (quote (ZETTEL "12345678901234")) "png")`, ""},
+		{provider, `(EMBED () (quote (ZETTEL "12345678901234")) "png")`, "Title"},
+		{provider, `(EMBED () (quote (ZETTEL "12345678901235")) "png")`, ""},
+		{nil, `(EMBED () (quote (ZETTEL "12345678901234")) "png" (TEXT "Desc"))`, "Desc"},
+		{provider, `(EMBED () (quote (ZETTEL "12345678901234")) "png" (TEXT "Desc"))`, "Desc"},
+		{provider, `(EMBED (quote (("alt" . "Alt"))) (quote (ZETTEL "12345678901234")) "png" (TEXT "Desc"))`, "Alt"},
+	}
+	for i, tc := range testcases {
+		tr := newTransformer(1, nil)
+		tr.SetAltTextProvider(tc.fn)
+		exp := `((img (@ (alt . "` + tc.exp + `") (src . "12345678901234"))))`
+		if strings.Contains(tc.src, "901235") {
+			exp = `((img (@ (alt . "` + tc.exp + `") (src . "12345678901235"))))`
+		}
+		if got := transform(t, tr, "(INLINE "+tc.src+")"); got != exp {
+			t.Errorf("%d: expected %s, but got %s", i, exp, got)
+		}
+	}
+}
+
+func TestEvalHandler(t *testing.T) {
+	const src = `(BLOCK (VERBATIM-EVAL (quote (("" . "mermaid"))) "graph TD; A-->B"))`
+	tr := newTransformer(1, nil)
+	exp := `((pre (code (@ (class . "zs-eval language-mermaid")) "graph TD; A-->B")))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("no handler: expected %s, but got %s", exp, got)
+	}
+
+	tr.SetEvalHandler(func(a attrs.Attributes, code string) (*sxpf.Pair, error) {
+		switch lang, _ := a.Get(""); lang {
+		case "mermaid":
+		case "plain":
+			return nil, nil
+		default:
+			return nil, errors.New("unknown language --" + lang + " ---x-")
+		}
+		return sxpf.MakeList(tr.Make("div"), sxpf.MakeList(tr.Make("@"), sxpf.Cons(tr.Make("class"), sxpf.MakeString("mermaid"))), sxpf.MakeString(code)), nil
+	})
+	exp = `((div (@ (class . "mermaid")) "graph TD; A-->B"))`
+	if got := transform(t, tr, src); got != exp {
+		t.Errorf("mermaid handler: expected %s, but got %s", exp, got)
+	}
+	exp = `((pre (code (@ (class . "zs-eval language-plain")) "text")))`
+	if got := transform(t, tr, `(BLOCK (VERBATIM-EVAL (quote (("" . "plain"))) "text"))`); got != exp {
+		t.Errorf("handler without result: expected %s, but got %s", exp, got)
+	}
+	exp = `((@@@ "unknown language - -dot - - -x- ") (pre (code (@ (class . "zs-eval zs-eval-error language-dot")) "digraph{}")))`
+	if got := transform(t, tr, `(BLOCK (VERBATIM-EVAL (quote (("" . "dot"))) "digraph{}"))`); got != exp {
+		t.Errorf("failing handler: expected %s, but got %s", exp, got)
+	}
+	exp = `((div (p "a") (@@@ "unknown language - -dot - - -x- ") (pre (code (@ (class . "zs-eval zs-eval-error language-dot")) "b"))))`
+	if got := transform(t, tr, `(BLOCK (REGION-BLOCK () (BLOCK (PARA (TEXT "a")) (VERBATIM-EVAL (quote (("" . "dot"))) "b"))))`); got != exp {
+		t.Errorf("failing handler in region: expected %s, but got %s", exp, got)
+	}
+	tr.SetKeepComments(false)
+	exp = `((pre (code (@ (class . "zs-eval zs-eval-error language-dot")) "digraph{}")))`
+	if got := transform(t, tr, `(BLOCK (VERBATIM-EVAL (quote (("" . "dot"))) "digraph{}"))`); got != exp {
+		t.Errorf("failing handler without comments: expected %s, but got %s", exp, got)
+	}
+
+	tr.SetEvalHandler(func(attrs.Attributes, string) (*sxpf.Pair, error) {
+		return sxpf.MakeList(sxpf.MakeList(tr.Make("div")), sxpf.MakeList(tr.Make("div"))), nil
+	})
+	exp = `(((div) (div)) (p "a"))`
+	if got := transform(t, tr, `(BLOCK (VERBATIM-EVAL () "x") (PARA (TEXT "a")))`); got != exp {
+		t.Errorf("handler result starting with a list: expected %s, but got %s", exp, got)
+	}
+}
+
+func TestTranscludeFallback(t *testing.T) {
+	tr := newTransformer(1, nil)
+	exp := `(((("k" . "v")) (ZETTEL "")) (p "a"))`
+	if got := transform(t, tr, `(BLOCK (TRANSCLUDE (quote (("k" . "v"))) (quote (ZETTEL ""))) (PARA (TEXT "a")))`); got != exp {
+		t.Errorf("expected %s, but got %s", exp, got)
+	}
+}
+
+const textCollectorDoc = `(BLOCK
+  (HEADING 1 () "h" "h" (INLINE (TEXT "Title")))
+  (PARA (TEXT "Some") (SPACE) (FORMAT-EMPH () (TEXT "emphasized")) (SOFT) (TEXT "text") (HARD)
+    (LINK-EXTERNAL () "https://zettelstore.de" (TEXT "link"))
+    (ENDNOTE () (quote (INLINE (TEXT "note"))))
+    (SPACE) (LITERAL-CODE () "x := 1"))
+  (UNORDERED (INLINE (TEXT "item")) (INLINE (TEXT "other")))
+  (VERBATIM-CODE () "fmt.Println()"))`
+
+func TestTextCollector(t *testing.T) {
+	ast := readAST(t, textCollectorDoc)
+	exp := text.EvaluateInlineString(ast)
+	if !strings.HasPrefix(exp, "TitleSome emphasized text\nlink ") {
+		t.Fatalf("unexpected text of text.Encoder: %q", exp)
+	}
+	tr := newTransformer(1, nil)
+	var sb strings.Builder
+	tr.SetTextCollector(&sb, false)
+	if _, err := tr.Transform(ast); err != nil {
+		t.Fatal(err)
+	}
+	tr.Endnotes()
+	if got := sb.String(); got != exp {
+		t.Errorf("expected text %q, but got %q", exp, got)
+	}
+
+	sb.Reset()
+	tr.SetTextCollector(&sb, true)
+	if _, err := tr.Transform(ast); err != nil {
+		t.Fatal(err)
+	}
+	tr.Endnotes()
+	if got := sb.String(); !strings.Contains(got, "x := 1") || !strings.HasSuffix(got, "fmt.Println()\n") {
+		t.Errorf("verbatim code missing: %q", got)
+	}
+
+	sb.Reset()
+	tr.SetTextCollector(nil, false)
+	if _, err := tr.Transform(ast); err != nil {
+		t.Fatal(err)
+	}
+	if sb.Len() != 0 {
+		t.Errorf("no text expected, but got %q", sb.String())
+	}
+}
+
+func BenchmarkTextSinglePass(b *testing.B) {
+	ast := readAST(b, textCollectorDoc)
+	tr := newTransformer(1, nil)
+	var sb strings.Builder
+	tr.SetTextCollector(&sb, false)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sb.Reset()
+		if _, err := tr.Transform(ast); err != nil {
+			b.Fatal(err)
+		}
+		tr.Endnotes()
+	}
+}
+
+func BenchmarkTextTwoPasses(b *testing.B) {
+	ast := readAST(b, textCollectorDoc)
+	tr := newTransformer(1, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.Transform(ast); err != nil {
+			b.Fatal(err)
+		}
+		tr.Endnotes()
+		_ = text.EvaluateInlineString(ast)
+	}
+}
+
+func BenchmarkTransformSmall(b *testing.B) {
+	benchmarkTransform(b, `(BLOCK (PARA (TEXT "Hello") (SPACE) (FORMAT-EMPH () (TEXT "World"))))`)
+}
+
+func BenchmarkTransformLarge(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString(`(BLOCK`)
+	for i := 0; i < 50; i++ {
+		sb.WriteString(` (HEADING 1 () "h" "h" (TEXT "Heading"))`)
+		sb.WriteString(` (PARA (TEXT "Some") (SPACE) (FORMAT-STRONG () (TEXT "text")) (SOFT)`)
+		sb.WriteString(` (LINK-EXTERNAL () "https://zettelstore.de" (TEXT "link"))`)
+		sb.WriteString(` (ENDNOTE () (quote (INLINE (TEXT "note")))))`)
+	}
+	sb.WriteString(`)`)
+	benchmarkTransform(b, sb.String())
+}
+
+func benchmarkTransform(b *testing.B, src string) {
+	tr := newTransformer(1, nil)
+	obj, err := reader.MakeReader(strings.NewReader(src), tr.ReaderOptions()...).Read()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ast := obj.(*sxpf.Pair)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.Transform(ast); err != nil {
+			b.Fatal(err)
+		}
+		tr.Endnotes()
+	}
+}
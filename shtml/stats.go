@@ -0,0 +1,88 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package shtml
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TransformStats collects statistics about transformations: how often every
+// AST node type was transformed, and the time spent transforming. It may be
+// shared by concurrent transformations.
+type TransformStats struct {
+	mx       sync.Mutex
+	counts   map[string]int
+	duration time.Duration
+}
+
+// TypeCount stores how often an AST node type was transformed.
+type TypeCount struct {
+	Name  string
+	Count int
+}
+
+// Count returns how often AST nodes of the given type were transformed.
+func (ts *TransformStats) Count(name string) int {
+	ts.mx.Lock()
+	defer ts.mx.Unlock()
+	return ts.counts[name]
+}
+
+// Duration returns the total time spent transforming.
+func (ts *TransformStats) Duration() time.Duration {
+	ts.mx.Lock()
+	defer ts.mx.Unlock()
+	return ts.duration
+}
+
+// TopTypes returns the n most frequently transformed AST node types, most
+// frequent first. Types with the same count are sorted by name. A n of zero
+// or less returns all types.
+func (ts *TransformStats) TopTypes(n int) []TypeCount {
+	ts.mx.Lock()
+	result := make([]TypeCount, 0, len(ts.counts))
+	for name, count := range ts.counts {
+		result = append(result, TypeCount{Name: name, Count: count})
+	}
+	ts.mx.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if n > 0 && n < len(result) {
+		result = result[:n]
+	}
+	return result
+}
+
+// Reset clears all statistics.
+func (ts *TransformStats) Reset() {
+	ts.mx.Lock()
+	ts.counts = nil
+	ts.duration = 0
+	ts.mx.Unlock()
+}
+
+func (ts *TransformStats) add(counts map[string]int, d time.Duration) {
+	ts.mx.Lock()
+	defer ts.mx.Unlock()
+	if ts.counts == nil {
+		ts.counts = make(map[string]int, len(counts))
+	}
+	for name, count := range counts {
+		ts.counts[name] += count
+	}
+	ts.duration += d
+}
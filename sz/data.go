@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package sz
+
+import (
+	"fmt"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/c/sx"
+	"zettelstore.de/sx.fossil/sxpf"
+)
+
+// DataZettel contains a zettel that was sent in data encoding, e.g.
+// (zettel (id "...") (meta (key "value") ...) (rights 4) (encoding "") (content "...")).
+type DataZettel struct {
+	ID       api.ZettelID
+	Meta     api.ZettelMeta
+	Rights   api.ZettelRights
+	Encoding string
+	Content  string
+}
+
+// ParseDataZettel parses a zettel in data encoding. In contrast to
+// GetMetaContent, which works on sz encoded zettel, the content is returned as
+// a string, and all symbols are checked.
+func ParseDataZettel(obj sxpf.Object) (DataZettel, error) {
+	vals, err := sx.ParseObject(obj, "yppppp")
+	if err != nil {
+		return DataZettel{}, err
+	}
+	if err = checkSymbol(vals[0], "zettel"); err != nil {
+		return DataZettel{}, err
+	}
+	id, err := parseSymbolValue(vals[1], "id", "s")
+	if err != nil {
+		return DataZettel{}, err
+	}
+	meta, err := ParseDataMeta(vals[2])
+	if err != nil {
+		return DataZettel{}, err
+	}
+	rights, err := parseSymbolValue(vals[3], "rights", "i")
+	if err != nil {
+		return DataZettel{}, err
+	}
+	encoding, err := parseSymbolValue(vals[4], "encoding", "s")
+	if err != nil {
+		return DataZettel{}, err
+	}
+	content, err := parseSymbolValue(vals[5], "content", "s")
+	if err != nil {
+		return DataZettel{}, err
+	}
+	return DataZettel{
+		ID:       api.ZettelID(id.(sxpf.String).String()),
+		Meta:     meta,
+		Rights:   api.ZettelRights(rights.(sxpf.Int64)),
+		Encoding: encoding.(sxpf.String).String(),
+		Content:  content.(sxpf.String).String(),
+	}, nil
+}
+
+// ParseDataMeta parses the metadata of a zettel in data encoding, i.e.
+// (meta (key "value") ...).
+func ParseDataMeta(obj sxpf.Object) (api.ZettelMeta, error) {
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair || pair == nil {
+		return nil, fmt.Errorf("metadata list expected, but got: %v", obj)
+	}
+	if err := checkSymbol(pair.Car(), "meta"); err != nil {
+		return nil, err
+	}
+	result := api.ZettelMeta{}
+	for node := pair.Tail(); node != nil; node = node.Tail() {
+		mVals, err := sx.ParseObject(node.Car(), "ys")
+		if err != nil {
+			return nil, fmt.Errorf("metadata %v: %w", node.Car(), err)
+		}
+		result[mVals[0].(*sxpf.Symbol).Name()] = mVals[1].(sxpf.String).String()
+	}
+	return result, nil
+}
+
+func parseSymbolValue(obj sxpf.Object, sym, spec string) (sxpf.Object, error) {
+	vals, err := sx.ParseObject(obj, "y"+spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sym, err)
+	}
+	if err = checkSymbol(vals[0], sym); err != nil {
+		return nil, err
+	}
+	return vals[1], nil
+}
+
+func checkSymbol(obj sxpf.Object, exp string) error {
+	sym, isSymbol := sxpf.GetSymbol(obj)
+	if !isSymbol {
+		return fmt.Errorf("symbol %q expected, but got: %v", exp, obj)
+	}
+	if got := sym.Name(); got != exp {
+		return fmt.Errorf("symbol %q expected, but got: %q", exp, got)
+	}
+	return nil
+}
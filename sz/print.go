@@ -0,0 +1,119 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package sz
+
+import (
+	"io"
+	"strings"
+
+	"zettelstore.de/sx.fossil/sxpf"
+)
+
+// PrintWidth is the maximum line length Print tries to achieve.
+const PrintWidth = 72
+
+// Print writes the given object in an indented form, useful for debugging.
+// Lists that fit into the remaining line are written on one line; other lists
+// place every element after the first one on its own line.
+func Print(w io.Writer, obj sxpf.Object) error { return PrintIndent(w, obj, "  ") }
+
+// PrintIndent works like Print, but uses the given string for indentation.
+func PrintIndent(w io.Writer, obj sxpf.Object, indent string) error {
+	p := printer{indent: indent}
+	p.print(obj, 0, 0)
+	p.sb.WriteByte('\n')
+	_, err := io.WriteString(w, p.sb.String())
+	return err
+}
+
+type printer struct {
+	sb     strings.Builder
+	indent string
+}
+
+func (p *printer) print(obj sxpf.Object, level, col int) {
+	flat := flatString(obj)
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair || pair == nil || col+len(flat) <= PrintWidth {
+		p.sb.WriteString(flat)
+		return
+	}
+	p.sb.WriteByte('(')
+	p.print(pair.Car(), level+1, col+1)
+	for node := pair; ; {
+		next, isNextPair := sxpf.GetPair(node.Cdr())
+		if !isNextPair {
+			p.sb.WriteString(" . ")
+			p.sb.WriteString(flatString(node.Cdr()))
+			break
+		}
+		if next == nil {
+			break
+		}
+		p.newline(level + 1)
+		p.print(next.Car(), level+1, (level+1)*len(p.indent))
+		node = next
+	}
+	p.sb.WriteByte(')')
+}
+
+func (p *printer) newline(level int) {
+	p.sb.WriteByte('\n')
+	for i := 0; i < level; i++ {
+		p.sb.WriteString(p.indent)
+	}
+}
+
+func flatString(obj sxpf.Object) string {
+	var sb strings.Builder
+	writeFlat(&sb, obj)
+	return sb.String()
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+func writeFlat(sb *strings.Builder, obj sxpf.Object) {
+	if sxpf.IsNil(obj) {
+		sb.WriteString("()")
+		return
+	}
+	if s, isString := sxpf.GetString(obj); isString {
+		sb.WriteByte('"')
+		sb.WriteString(stringEscaper.Replace(s.String()))
+		sb.WriteByte('"')
+		return
+	}
+	if sym, isSymbol := sxpf.GetSymbol(obj); isSymbol {
+		sb.WriteString(sym.Name())
+		return
+	}
+	pair, isPair := sxpf.GetPair(obj)
+	if !isPair {
+		sb.WriteString(obj.String())
+		return
+	}
+	sb.WriteByte('(')
+	for node := pair; ; {
+		writeFlat(sb, node.Car())
+		next, isNextPair := sxpf.GetPair(node.Cdr())
+		if !isNextPair {
+			sb.WriteString(" . ")
+			writeFlat(sb, node.Cdr())
+			break
+		}
+		if next == nil {
+			break
+		}
+		sb.WriteByte(' ')
+		node = next
+	}
+	sb.WriteByte(')')
+}
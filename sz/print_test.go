@@ -0,0 +1,78 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package sz_test
+
+import (
+	"strings"
+	"testing"
+
+	"zettelstore.de/c/sz"
+	"zettelstore.de/sx.fossil/sxpf/reader"
+)
+
+func TestPrint(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{`()`, "()\n"},
+		{`"a\"b"`, "\"a\\\"b\"\n"},
+		{`(PARA (TEXT "short"))`, "(PARA (TEXT \"short\"))\n"},
+		{`(("a" . "b") ("c" . "d"))`, "((\"a\" . \"b\") (\"c\" . \"d\"))\n"},
+		{`(BLOCK (HEADING 1 () "Heading" "heading" (INLINE (TEXT "Heading"))) (PARA (TEXT "This") (SPACE) (TEXT "is") (SPACE) (TEXT "a") (SPACE) (TEXT "long") (SPACE) (TEXT "paragraph"))` +
+			` (ORDERED (INLINE (TEXT "Item")) (BLOCK (PARA (TEXT "Another") (SPACE) (TEXT "item") (SPACE) (TEXT "that") (SPACE) (TEXT "is") (SPACE) (TEXT "nested"))))))`,
+			`(BLOCK
+  (HEADING 1 () "Heading" "heading" (INLINE (TEXT "Heading")))
+  (PARA
+    (TEXT "This")
+    (SPACE)
+    (TEXT "is")
+    (SPACE)
+    (TEXT "a")
+    (SPACE)
+    (TEXT "long")
+    (SPACE)
+    (TEXT "paragraph"))
+  (ORDERED
+    (INLINE (TEXT "Item"))
+    (BLOCK
+      (PARA
+        (TEXT "Another")
+        (SPACE)
+        (TEXT "item")
+        (SPACE)
+        (TEXT "that")
+        (SPACE)
+        (TEXT "is")
+        (SPACE)
+        (TEXT "nested")))))
+`},
+	}
+	for i, tc := range testcases {
+		obj, err := reader.MakeReader(strings.NewReader(tc.src)).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sb1, sb2 strings.Builder
+		if err = sz.Print(&sb1, obj); err != nil {
+			t.Fatal(err)
+		}
+		if got := sb1.String(); got != tc.exp {
+			t.Errorf("%d: expected:\n%s\nbut got:\n%s", i, tc.exp, got)
+		}
+		if err = sz.Print(&sb2, obj); err != nil {
+			t.Fatal(err)
+		}
+		if sb1.String() != sb2.String() {
+			t.Errorf("%d: output not stable", i)
+		}
+	}
+}
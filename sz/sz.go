@@ -11,6 +11,9 @@
 package sz
 
 import (
+	"time"
+
+	"zettelstore.de/c/api"
 	"zettelstore.de/c/attrs"
 	"zettelstore.de/sx.fossil/sxpf"
 )
@@ -38,7 +41,9 @@ func GetAttributes(seq *sxpf.Pair) (result attrs.Attributes) {
 	return result
 }
 
-// GetMetaContent returns the metadata and the content of a sz encoded zettel.
+// GetMetaContent returns the metadata and the content of a sz encoded zettel,
+// i.e. a list of the metadata list and the content list. For zettel in data
+// encoding, use ParseDataZettel.
 func GetMetaContent(zettel sxpf.Object) (Meta, *sxpf.Pair) {
 	if pair, isPair := sxpf.GetPair(zettel); isPair {
 		m := pair.Car()
@@ -132,3 +137,106 @@ func (m Meta) GetPair(key string) *sxpf.Pair {
 	}
 	return nil
 }
+
+// GetTags returns the tags stored under the given key, if its type is a tag set.
+func (m Meta) GetTags(key string) []string {
+	if mv, found := m[key]; found && mv.Type == NameSymTypeTagSet {
+		return mv.stringList()
+	}
+	return nil
+}
+
+// GetZids returns the zettel identifier stored under the given key, if its
+// type is an identifier or a set of identifier. If one of the identifier is
+// not valid, nil is returned.
+func (m Meta) GetZids(key string) []api.ZettelID {
+	mv, found := m[key]
+	if !found || (mv.Type != NameSymTypeID && mv.Type != NameSymTypeIDSet) {
+		return nil
+	}
+	values := mv.stringList()
+	if len(values) == 0 {
+		return nil
+	}
+	result := make([]api.ZettelID, 0, len(values))
+	for _, val := range values {
+		zid := api.ZettelID(val)
+		if !zid.IsValid() {
+			return nil
+		}
+		result = append(result, zid)
+	}
+	return result
+}
+
+// GetZid returns the zettel identifier stored under the given key, if its type
+// is an identifier and the identifier is valid.
+func (m Meta) GetZid(key string) (api.ZettelID, bool) {
+	if mv, found := m[key]; found && mv.Type == NameSymTypeID {
+		if s, isString := sxpf.GetString(mv.Value); isString {
+			if zid := api.ZettelID(s.String()); zid.IsValid() {
+				return zid, true
+			}
+		}
+	}
+	return api.InvalidZID, false
+}
+
+// GetTime returns the time of a timestamp stored under the given key.
+func (m Meta) GetTime(key string) (time.Time, bool) {
+	if mv, found := m[key]; found && mv.Type == NameSymTypeTimestamp {
+		if s, isString := sxpf.GetString(mv.Value); isString {
+			return api.ParseTimestamp(s.String())
+		}
+	}
+	return time.Time{}, false
+}
+
+// GetBool returns the boolean value stored under the given key. Like the
+// Zettelstore, any value that does not start with "0", "f", "F", "n", or "N"
+// is true. Values of a set type, a timestamp, or an identifier are never true.
+func (m Meta) GetBool(key string) bool {
+	mv, found := m[key]
+	if !found {
+		return false
+	}
+	switch mv.Type {
+	case NameSymTypeEmpty, NameSymTypeNumber, NameSymTypeString, NameSymTypeWord:
+	default:
+		return false
+	}
+	s, isString := sxpf.GetString(mv.Value)
+	if !isString || s == "" {
+		return false
+	}
+	switch s[0] {
+	case '0', 'f', 'F', 'n', 'N':
+		return false
+	}
+	return true
+}
+
+// stringList returns the strings of a set value. A set is either a list of
+// strings, optionally starting with a symbol, or a string of space separated
+// values.
+func (mv *MetaValue) stringList() []string {
+	if s, isString := sxpf.GetString(mv.Value); isString {
+		return api.ParseWordSet(s.String())
+	}
+	pair, isPair := sxpf.GetPair(mv.Value)
+	if !isPair || pair == nil {
+		return nil
+	}
+	if _, isSymbol := sxpf.GetSymbol(pair.Car()); isSymbol {
+		pair = pair.Tail()
+	}
+	var result []string
+	for node := pair; node != nil; node = node.Tail() {
+		s, isString := sxpf.GetString(node.Car())
+		if !isString {
+			return nil
+		}
+		result = append(result, s.String())
+	}
+	return result
+}
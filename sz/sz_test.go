@@ -0,0 +1,181 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package sz_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zettelstore.de/c/api"
+	"zettelstore.de/c/sz"
+	"zettelstore.de/sx.fossil/sxpf/reader"
+)
+
+func makeMeta(t *testing.T, src string) sz.Meta {
+	t.Helper()
+	obj, err := reader.MakeReader(strings.NewReader(src)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sz.MakeMeta(obj)
+}
+
+func TestMetaGetTags(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{`((TAG-SET 'tags ("#a" "#b")))`, "#a #b"},
+		{`((TAG-SET 'tags (LIST "#a" "#b")))`, "#a #b"},
+		{`((TAG-SET 'tags "#a #b"))`, "#a #b"},
+		{`((TAG-SET 'tags ("#a" 1)))`, ""},
+		{`((WORD-SET 'tags ("#a")))`, ""},
+		{`((TAG-SET 'other ("#a")))`, ""},
+	}
+	for i, tc := range testcases {
+		if got := strings.Join(makeMeta(t, tc.src).GetTags(api.KeyTags), " "); got != tc.exp {
+			t.Errorf("%d: %s: expected %q, but got %q", i, tc.src, tc.exp, got)
+		}
+	}
+}
+
+func TestMetaGetZids(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{`((ZID 'id "20230101000000"))`, "20230101000000"},
+		{`((ZID-SET 'id ("20230101000000" "20230102000000")))`, "20230101000000 20230102000000"},
+		{`((ZID-SET 'id "20230101000000 20230102000000"))`, "20230101000000 20230102000000"},
+		{`((ZID-SET 'id ("20230101000000" "invalid")))`, ""},
+		{`((ZID 'id "123"))`, ""},
+		{`((STRING 'id "20230101000000"))`, ""},
+		{`((ZID 'id 17))`, ""},
+	}
+	for i, tc := range testcases {
+		var sb strings.Builder
+		for j, zid := range makeMeta(t, tc.src).GetZids(api.KeyID) {
+			if j > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(string(zid))
+		}
+		if got := sb.String(); got != tc.exp {
+			t.Errorf("%d: %s: expected %q, but got %q", i, tc.src, tc.exp, got)
+		}
+	}
+}
+
+func TestMetaGetZid(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp api.ZettelID
+		ok  bool
+	}{
+		{`((ZID 'precursor "20230101000000"))`, "20230101000000", true},
+		{`((ZID 'precursor "123"))`, api.InvalidZID, false},
+		{`((ZID-SET 'precursor ("20230101000000")))`, api.InvalidZID, false},
+		{`((STRING 'precursor "20230101000000"))`, api.InvalidZID, false},
+		{`((ZID 'precursor 17))`, api.InvalidZID, false},
+		{`()`, api.InvalidZID, false},
+	}
+	for i, tc := range testcases {
+		got, ok := makeMeta(t, tc.src).GetZid(api.KeyPrecursor)
+		if got != tc.exp || ok != tc.ok {
+			t.Errorf("%d: %s: expected %q/%v, but got %q/%v", i, tc.src, tc.exp, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestMetaGetTime(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp time.Time
+		ok  bool
+	}{
+		{`((TIMESTAMP 'created "20230704120102"))`, time.Date(2023, 7, 4, 12, 1, 2, 0, time.Local), true},
+		{`((TIMESTAMP 'created "2023070412"))`, time.Time{}, false},
+		{`((TIMESTAMP 'created "20231304120102"))`, time.Time{}, false},
+		{`((STRING 'created "20230704120102"))`, time.Time{}, false},
+		{`((TIMESTAMP 'created ("20230704120102")))`, time.Time{}, false},
+	}
+	for i, tc := range testcases {
+		got, ok := makeMeta(t, tc.src).GetTime(api.KeyCreated)
+		if ok != tc.ok || !got.Equal(tc.exp) {
+			t.Errorf("%d: %s: expected %v/%v, but got %v/%v", i, tc.src, tc.exp, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestMetaGetBool(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp bool
+	}{
+		{`((WORD 'read-only "true"))`, true},
+		{`((WORD 'read-only "yes"))`, true},
+		{`((WORD 'read-only "false"))`, false},
+		{`((WORD 'read-only "No"))`, false},
+		{`((NUMBER 'read-only "0"))`, false},
+		{`((STRING 'read-only "1"))`, true},
+		{`((EMPTY-STRING 'read-only ""))`, false},
+		{`((WORD-SET 'read-only ("true")))`, false},
+		{`((TIMESTAMP 'read-only "20230704120102"))`, false},
+		{`((WORD 'read-only 1))`, false},
+		{`()`, false},
+	}
+	for i, tc := range testcases {
+		if got := makeMeta(t, tc.src).GetBool(api.KeyReadOnly); got != tc.exp {
+			t.Errorf("%d: %s: expected %v, but got %v", i, tc.src, tc.exp, got)
+		}
+	}
+}
+
+func TestParseDataZettel(t *testing.T) {
+	const src = `(zettel (id "00010000000000") (meta (title "Home") (role "zettel") (syntax "zmk"))
+  (rights 6) (encoding "") (content "=== Welcome"))`
+	obj, err := reader.MakeReader(strings.NewReader(src)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zettel, err := sz.ParseDataZettel(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zettel.ID != api.ZidDefaultHome || zettel.Rights != 6 || zettel.Encoding != "" || zettel.Content != "=== Welcome" {
+		t.Errorf("unexpected zettel %v", zettel)
+	}
+	if len(zettel.Meta) != 3 || zettel.Meta[api.KeyTitle] != "Home" || zettel.Meta[api.KeySyntax] != "zmk" {
+		t.Errorf("unexpected metadata %v", zettel.Meta)
+	}
+
+	testcases := []struct {
+		src    string
+		errMsg string
+	}{
+		{`((meta) (content "c"))`, "spec"},
+		{`(zettl (id "1") (meta) (rights 6) (encoding "") (content ""))`, `"zettel" expected`},
+		{`(zettel (id "1") (mta) (rights 6) (encoding "") (content ""))`, `"meta" expected`},
+		{`(zettel (id "1") (meta (title 1)) (rights 6) (encoding "") (content ""))`, "metadata"},
+		{`(zettel (id "1") (meta) (rights "6") (encoding "") (content ""))`, "rights"},
+		{`(zettel (id "1") (meta) (rights 6) (content "") (encoding ""))`, `"encoding" expected`},
+	}
+	for i, tc := range testcases {
+		obj, err = reader.MakeReader(strings.NewReader(tc.src)).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = sz.ParseDataZettel(obj); err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+			t.Errorf("%d: expected error containing %q, but got %v", i, tc.errMsg, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package text
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Slugify returns a string that can be used as an anchor. It contains only
+// lower case ASCII letters, digits, and single hyphens between them. All other
+// characters are treated as separators. Therefore, the result is empty, if the
+// given string does not contain any ASCII letter or digit.
+func Slugify(s string) string {
+	var sb strings.Builder
+	sep := false
+	for _, r := range s {
+		if 'A' <= r && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if sep && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	return sb.String()
+}
+
+// AnchorFor returns an anchor for the given string, e.g. the text of a
+// heading. It is the result of Slugify, if that is not empty. Otherwise, a
+// short anchor is derived from a hash of the string, like "h-3fa2c1", so that
+// it is stable across calls. Only a string that consists of white space
+// results in an empty anchor.
+func AnchorFor(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return ""
+	}
+	if slug := Slugify(s); slug != "" {
+		return slug
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("h-%06x", h.Sum32()&0xffffff)
+}
+
+// Anchors is a set of anchors that are used within one document. The zero
+// value is an empty set.
+type Anchors struct {
+	used map[string]bool
+}
+
+// Add adds the given anchor to the set and returns it. If the anchor was
+// already used, a suffix "-2", "-3", ... is appended to make it unique.
+func (a *Anchors) Add(anchor string) string {
+	if a.used == nil {
+		a.used = make(map[string]bool)
+	}
+	result := anchor
+	for n := 2; a.used[result]; n++ {
+		result = anchor + "-" + strconv.Itoa(n)
+	}
+	a.used[result] = true
+	return result
+}
+
+// Make returns the unique anchor of the given string, see AnchorFor and Add.
+func (a *Anchors) Make(s string) string {
+	anchor := AnchorFor(s)
+	if anchor == "" {
+		return ""
+	}
+	return a.Add(anchor)
+}
@@ -0,0 +1,171 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2023-present Detlef Stern
+//
+// This file is part of zettelstore-client.
+//
+// Zettelstore client is licensed under the latest version of the EUPL
+// (European Union Public License). Please see file LICENSE.txt for your rights
+// and obligations under this license.
+//-----------------------------------------------------------------------------
+
+package text
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"zettelstore.de/sx.fossil/sxpf"
+)
+
+// Ellipsis marks text that was cut off by Snippet.
+const Ellipsis = "…"
+
+// Snippet extracts the plain text of the given list and returns a part of it
+// with at most maxLen bytes (plus ellipses), which contains the first match of
+// one of the given terms. If no term matches, the start of the text is
+// returned. A maxLen of zero or less does not shorten the text.
+//
+// Terms are matched with simple Unicode case folding, i.e. "ß" does not match
+// "ss". The snippet is cut at word boundaries, if possible. The returned
+// ranges contain the start and end byte positions of all matches within the
+// snippet, sorted and without overlaps, so that the caller can emphasize them.
+func Snippet(lst *sxpf.Pair, terms []string, maxLen int) (snippet string, ranges [][2]int) {
+	s := strings.Join(strings.Fields(EvaluateInlineString(lst)), " ")
+	matches := findMatches(s, terms)
+
+	start, end := 0, len(s)
+	if maxLen > 0 && len(s) > maxLen {
+		start, end = snippetWindow(s, matches, maxLen)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString(Ellipsis)
+	}
+	offset := sb.Len() - start
+	sb.WriteString(s[start:end])
+	if end < len(s) {
+		sb.WriteString(Ellipsis)
+	}
+
+	for _, m := range matches {
+		if m[1] <= start || end <= m[0] {
+			continue
+		}
+		ranges = append(ranges, [2]int{max(m[0], start) + offset, min(m[1], end) + offset})
+	}
+	return sb.String(), ranges
+}
+
+// findMatches returns the merged byte ranges of all term matches in s.
+func findMatches(s string, terms []string) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(s); {
+		for _, term := range terms {
+			if n := matchFold(s[i:], term); n > 0 {
+				result = append(result, [2]int{i, i + n})
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	merged := result[:1]
+	for _, r := range result[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			last[1] = max(last[1], r[1])
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// matchFold returns the number of bytes of s that match the term, if s starts
+// with the term under simple case folding. Otherwise it returns zero.
+func matchFold(s, term string) int {
+	if term == "" {
+		return 0
+	}
+	pos := 0
+	for _, tr := range term {
+		if pos >= len(s) {
+			return 0
+		}
+		sr, size := utf8.DecodeRuneInString(s[pos:])
+		if !equalFoldRune(sr, tr) {
+			return 0
+		}
+		pos += size
+	}
+	return pos
+}
+
+func equalFoldRune(r1, r2 rune) bool {
+	if r1 == r2 {
+		return true
+	}
+	for r := unicode.SimpleFold(r1); r != r1; r = unicode.SimpleFold(r) {
+		if r == r2 {
+			return true
+		}
+	}
+	return false
+}
+
+// snippetWindow calculates the byte range of s to be shown, with a length of
+// at most maxLen.
+func snippetWindow(s string, matches [][2]int, maxLen int) (int, int) {
+	start := 0
+	if len(matches) > 0 {
+		// Show some context before the first match.
+		start = max(0, matches[0][0]-maxLen/4)
+		if start+maxLen > len(s) {
+			start = len(s) - maxLen
+		}
+		if start > 0 {
+			if pos := strings.IndexByte(s[start:], ' '); pos >= 0 && start+pos < matches[0][0] {
+				start += pos + 1
+			} else {
+				start = runeStart(s, start)
+			}
+		}
+	}
+	end := min(start+maxLen, len(s))
+	if end < len(s) {
+		if pos := strings.LastIndexByte(s[start:end+1], ' '); pos > 0 {
+			end = start + pos
+		} else {
+			end = runeStart(s, end)
+		}
+	}
+	return start, end
+}
+
+// runeStart returns the largest position not after pos, where a rune starts.
+func runeStart(s string, pos int) int {
+	for pos > 0 && !utf8.RuneStart(s[pos]) {
+		pos--
+	}
+	return pos
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
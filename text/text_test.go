@@ -44,3 +44,111 @@ func TestSzText(t *testing.T) {
 		}
 	}
 }
+
+func TestSnippet(t *testing.T) {
+	src := `(INLINE (TEXT "The") (SPACE) (TEXT "quick") (SPACE) (TEXT "brown") (SPACE) (TEXT "Fox") (SOFT) (TEXT "jumps") (SPACE) (TEXT "over") (SPACE) (TEXT "the") (SPACE) (TEXT "lazy") (SPACE) (TEXT "dog"))`
+	sval, err := reader.MakeReader(strings.NewReader(src)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lst, _ := sxpf.GetPair(sval)
+	testcases := []struct {
+		terms  []string
+		maxLen int
+		exp    string
+		marked string
+	}{
+		{nil, 0, "The quick brown Fox jumps over the lazy dog", ""},
+		{nil, 16, "The quick brown…", ""},
+		{[]string{"fox"}, 0, "The quick brown Fox jumps over the lazy dog", "Fox"},
+		{[]string{"THE"}, 0, "The quick brown Fox jumps over the lazy dog", "The|the"},
+		{[]string{"lazy"}, 16, "…the lazy dog", "lazy"},
+		{[]string{"jumps"}, 20, "…Fox jumps over the…", "jumps"},
+		{[]string{"dog"}, 12, "…lazy dog", "dog"},
+		{[]string{"umps", "jump"}, 0, "The quick brown Fox jumps over the lazy dog", "jumps"},
+		{[]string{"cat"}, 10, "The quick…", ""},
+		{[]string{"ss"}, 0, "The quick brown Fox jumps over the lazy dog", ""},
+	}
+	for i, tc := range testcases {
+		got, ranges := text.Snippet(lst, tc.terms, tc.maxLen)
+		if got != tc.exp {
+			t.Errorf("%d: Snippet(%v, %d) should be %q, but got %q", i, tc.terms, tc.maxLen, tc.exp, got)
+			continue
+		}
+		marks := make([]string, len(ranges))
+		for j, r := range ranges {
+			marks[j] = got[r[0]:r[1]]
+		}
+		if marked := strings.Join(marks, "|"); marked != tc.marked {
+			t.Errorf("%d: Snippet(%v, %d) should mark %q, but got %q", i, tc.terms, tc.maxLen, tc.marked, marked)
+		}
+	}
+}
+
+func TestSnippetFold(t *testing.T) {
+	src := `(INLINE (TEXT "Straße und STRASSE, ǅemal"))`
+	sval, err := reader.MakeReader(strings.NewReader(src)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lst, _ := sxpf.GetPair(sval)
+	testcases := []struct {
+		term   string
+		marked string
+	}{
+		{"straße", "Straße"},
+		{"strasse", "STRASSE"}, // "ß" and "ss" are not folded together.
+		{"ǆ", "ǅ"},
+	}
+	for i, tc := range testcases {
+		got, ranges := text.Snippet(lst, []string{tc.term}, 0)
+		marks := make([]string, len(ranges))
+		for j, r := range ranges {
+			marks[j] = got[r[0]:r[1]]
+		}
+		if marked := strings.Join(marks, "|"); marked != tc.marked {
+			t.Errorf("%d: %q should mark %q, but got %q", i, tc.term, tc.marked, marked)
+		}
+	}
+}
+
+func TestAnchorFor(t *testing.T) {
+	testcases := []struct {
+		src string
+		exp string
+	}{
+		{"", ""},
+		{" \t", ""},
+		{"Hello, World!", "hello-world"},
+		{"  2. Über  uns ", "2-ber-uns"},
+	}
+	for _, tc := range testcases {
+		if got := text.AnchorFor(tc.src); got != tc.exp {
+			t.Errorf("AnchorFor(%q): expected %q, but got %q", tc.src, tc.exp, got)
+		}
+	}
+
+	for _, s := range []string{"日本語", "🎉🎉", "见 面"} {
+		anchor := text.AnchorFor(s)
+		if len(anchor) != len("h-123456") || !strings.HasPrefix(anchor, "h-") {
+			t.Errorf("AnchorFor(%q): expected hash anchor, but got %q", s, anchor)
+		}
+		if again := text.AnchorFor(" " + s + " "); again != anchor {
+			t.Errorf("AnchorFor(%q) is not stable: %q != %q", s, anchor, again)
+		}
+	}
+	if text.AnchorFor("日本語") == text.AnchorFor("中文") {
+		t.Error("different strings should result in different anchors")
+	}
+
+	var anchors text.Anchors
+	var got []string
+	for _, s := range []string{"A b", "a-b", "日本語", "A B", "日本語", " "} {
+		got = append(got, anchors.Make(s))
+	}
+	jp := text.AnchorFor("日本語")
+	exp := []string{"a-b", "a-b-2", jp, "a-b-3", jp + "-2", ""}
+	if strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Errorf("expected anchors %v, but got %v", exp, got)
+	}
+}